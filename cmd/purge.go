@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/arwoosa/post/pkg/logging"
+	"github.com/arwoosa/post/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// purgeCmd represents the purge command
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently delete ideas that stayed in the trash too long",
+	Long: `The purge command permanently deletes ideas that were moved to the trash
+more than --days days ago. Without --days it uses trash.retention_days, e.g.:
+
+  post purge --days 7`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		days := viper.GetInt("trash.retention_days")
+		if cmd.Flags().Changed("days") {
+			days, _ = cmd.Flags().GetInt("days")
+		}
+		if days <= 0 {
+			return fmt.Errorf("days must be greater than zero")
+		}
+		client, err := newManticore()
+		if err != nil {
+			return err
+		}
+		svc := service.NewIdeaService(client)
+		purged, err := svc.PurgeTrash(context.Background(), time.Duration(days)*24*time.Hour)
+		if err != nil {
+			slog.Error("purge trash failed", "purged", purged, logging.KeyError, err.Error())
+			return err
+		}
+		fmt.Printf("purged %d ideas deleted more than %d days ago\n", purged, days)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(purgeCmd)
+
+	purgeCmd.Flags().Int("days", 0, "purge ideas deleted more than this many days ago (default trash.retention_days)")
+}
@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 
@@ -78,5 +79,5 @@ func initConfig() {
 }
 
 func showInfo() {
-	fmt.Println("Date:", config.Date, "Commit:", config.Commit)
+	slog.Info("build info", "date", config.Date, "commit", config.Commit)
 }
@@ -0,0 +1,28 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/arwoosa/post/model"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the Manticore table schema used by the service",
+	Long: `The schema command prints the CREATE TABLE statement of the idea table.
+Apply it with any MySQL client connected to Manticore, e.g.:
+
+  post schema | mysql -h127.0.0.1 -P9306`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(model.IdeaTableSchema("idea") + ";")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
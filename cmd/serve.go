@@ -4,11 +4,24 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/94peter/microservice"
+	"github.com/arwoosa/post/pkg/auth"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/arwoosa/post/pkg/cache"
+	"github.com/arwoosa/post/pkg/eventlog"
+	"github.com/arwoosa/post/pkg/logging"
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/arwoosa/post/pkg/metrics"
+	"github.com/arwoosa/post/pkg/ratelimit"
+	"github.com/arwoosa/post/pkg/resilience"
+	"github.com/arwoosa/post/pkg/tracing"
 	"github.com/arwoosa/post/router"
+	"github.com/arwoosa/post/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -21,17 +34,254 @@ var serveCmd = &cobra.Command{
 It initializes the necessary APIs (e.g., post, health check).
 Additionally, it can run a test API for local development to simulate API requests from other microservices.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		closeLog, err := logging.Setup()
+		if err != nil {
+			fatal(err)
+			return
+		}
+		defer closeLog()
 		showInfo()
-		fmt.Println("serve called", viper.GetString("service"))
-		apiServ, err := microservice.NewApiWithViper(microservice.WithAPI(router.GetApis()...))
+		slog.Info("serve called", "service", viper.GetString("service"))
+		shutdownTracing, err := tracing.Setup(viper.GetString("service"))
+		if err != nil {
+			fatal(err)
+			return
+		}
+		client, err := newManticore()
+		if err != nil {
+			fatal(err)
+			return
+		}
+		indexVersion := service.NewLocalIndexVersion()
+		routerOpts := []router.Option{
+			router.WithManticore(client),
+			router.WithSearchAnalytics(service.NewSearchAnalytics()),
+			router.WithIndexVersion(indexVersion),
+		}
+		// 背景工作寫入 idea 時，需清除與 API 相同的快取並遞增相同的索引版本
+		ideaOpts := []service.IdeaServiceOption{service.WithIndexVersion(indexVersion)}
+		var searchCache *service.SearchCache
+		if viper.GetBool("cache.enabled") {
+			searchCache, err = newSearchCache()
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithSearchCache(searchCache))
+			ideaOpts = append(ideaOpts, service.WithSearchCache(searchCache))
+		}
+		workers, err := newScheduleSweeper(client, ideaOpts...)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 			return
 		}
-		microservice.RunService(apiServ)
+		if viper.GetString("events.path") != "" {
+			events, handlers, err := newEventService(client, service.WithRollupInvalidation(searchCache, indexVersion))
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithEventService(events))
+			workers = append(workers, handlers...)
+		}
+		if viper.GetBool("auth.enabled") {
+			verifier, err := newVerifier()
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithAuth(verifier))
+		}
+		if viper.GetBool("authz.enabled") {
+			// 未啟用 auth 時角色與身分來自 X-User-Roles 與 X-User-Id，只有 API gateway 會覆寫這兩個標頭時才可信任
+			if !viper.GetBool("auth.enabled") && !viper.GetBool("authz.trust_gateway_headers") {
+				fatal(fmt.Errorf("authz.enabled requires auth.enabled, or authz.trust_gateway_headers when an API gateway sets X-User-Id and X-User-Roles"))
+				return
+			}
+			policy, err := authz.LoadPolicy()
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithPolicy(policy))
+		}
+		// rate limit 與搜尋事件去重都以 IP 識別匿名的 client
+		proxies, err := ratelimit.LoadTrustedProxies()
+		if err != nil {
+			fatal(err)
+			return
+		}
+		routerOpts = append(routerOpts, router.WithTrustedProxies(proxies...))
+		if viper.GetBool("ratelimit.enabled") {
+			limiter, err := newRateLimiter()
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithRateLimit(limiter, viper.GetStringSlice("ratelimit.api_keys")...))
+		}
+		if viper.GetBool("tracing.enabled") {
+			routerOpts = append(routerOpts, router.WithTracing(viper.GetString("service")))
+		}
+		if viper.GetBool("metrics.enabled") {
+			handler, err := newHealthWatcher(client)
+			if err != nil {
+				fatal(err)
+				return
+			}
+			routerOpts = append(routerOpts, router.WithMetrics(viper.GetString("metrics.path")))
+			workers = append(workers, handler)
+		}
+		apiServ, err := microservice.NewApiWithViper(
+			microservice.WithMiddle(router.GetMiddles(routerOpts...)...),
+			microservice.WithAPI(router.GetApis(routerOpts...)...),
+		)
+		if err != nil {
+			fatal(err)
+			return
+		}
+		microservice.RunService(append([]microservice.ServiceHandler{apiServ}, workers...)...)
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("shutdown tracing failed", logging.KeyError, err.Error())
+		}
 	},
 }
 
+// fatal 記錄無法啟動服務的錯誤並結束程式
+func fatal(err error) {
+	slog.Error("start service failed", logging.KeyError, err.Error())
+	os.Exit(1)
+}
+
+// newManticore 創建記錄錯誤與指標，並依 resilience 設定重試與斷路的 Manticore client，
+// 整個服務共用同一個實例
+func newManticore() (manticore.ManticoreService, error) {
+	policies, err := resilience.LoadPolicies()
+	if err != nil {
+		return nil, err
+	}
+	client, err := manticore.NewManticore()
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Manticore(logging.Manticore(resilience.Manticore(client, policies))), nil
+}
+
+// newVerifier 依 auth 設定創建驗證寫入與管理路由 JWT 的 Verifier
+func newVerifier() (*auth.Verifier, error) {
+	cfg, err := auth.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewVerifier(cfg)
+}
+
+// newRateLimiter 依 ratelimit 設定創建以行程內 bucket 限制請求的 Limiter
+func newRateLimiter() (*ratelimit.Limiter, error) {
+	budgets, err := ratelimit.LoadBudgets()
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.NewLimiter(ratelimit.NewMemory(), budgets)
+}
+
+// newSearchCache 依 cache 設定創建行程內的搜尋結果快取
+func newSearchCache() (*service.SearchCache, error) {
+	backend, err := cache.NewLRU(viper.GetInt("cache.capacity"))
+	if err != nil {
+		return nil, err
+	}
+	return service.NewSearchCache(backend, viper.GetDuration("cache.ttl")), nil
+}
+
+// newEventService 依 events 設定創建搜尋事件紀錄，
+// 並回傳定期寫入事件與彙總熱門度的背景工作
+func newEventService(client manticore.ManticoreService, opts ...service.EventServiceOption) (*service.EventService, []microservice.ServiceHandler, error) {
+	store, err := eventlog.NewStore(
+		viper.GetString("events.path"),
+		viper.GetInt("events.batch_size"),
+		viper.GetDuration("events.flush_interval"),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	rollupInterval := viper.GetDuration("events.rollup_interval")
+	if rollupInterval <= 0 {
+		return nil, nil, fmt.Errorf("events.rollup_interval must be greater than zero")
+	}
+	dedupeWindow := viper.GetDuration("events.dedupe_window")
+	if dedupeWindow <= 0 {
+		return nil, nil, fmt.Errorf("events.dedupe_window must be greater than zero")
+	}
+	opts = append(opts, service.WithDedupeWindow(dedupeWindow))
+	events := service.NewEventService(client, store, opts...)
+
+	handlers := []microservice.ServiceHandler{
+		func(ctx context.Context) {
+			onError := func(err error) {
+				slog.ErrorContext(ctx, "flush search events failed", logging.KeyError, err.Error())
+			}
+			if err := store.Run(ctx, onError); err != nil {
+				onError(err)
+			}
+		},
+		func(ctx context.Context) {
+			events.RunRollup(ctx, rollupInterval)
+		},
+	}
+	return events, handlers, nil
+}
+
+// newScheduleSweeper 回傳定期下架到期 idea 的背景工作，
+// 設定 schedule.events_path 時另外回傳定期寫入 idea 事件的背景工作
+func newScheduleSweeper(client manticore.ManticoreService, opts ...service.IdeaServiceOption) ([]microservice.ServiceHandler, error) {
+	// 排程的 idea 到達 publish_at 或 expire_at 時由背景工作清除快取並遞增索引版本，
+	// 停用時搜尋快取與 GET /idea 的 ETag 會停留在排程生效前的結果
+	interval := viper.GetDuration("schedule.sweep_interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("schedule.sweep_interval must be greater than zero")
+	}
+	var handlers []microservice.ServiceHandler
+	if path := viper.GetString("schedule.events_path"); path != "" {
+		store, err := eventlog.NewStore(
+			path,
+			viper.GetInt("events.batch_size"),
+			viper.GetDuration("events.flush_interval"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, service.WithIdeaEvents(store))
+		handlers = append(handlers, func(ctx context.Context) {
+			onError := func(err error) {
+				slog.ErrorContext(ctx, "flush idea events failed", logging.KeyError, err.Error())
+			}
+			if err := store.Run(ctx, onError); err != nil {
+				onError(err)
+			}
+		})
+	}
+	svc := service.NewIdeaService(client, opts...)
+	handlers = append(handlers, func(ctx context.Context) {
+		svc.RunScheduleSweeper(ctx, interval)
+	})
+	return handlers, nil
+}
+
+// newHealthWatcher 回傳定期檢查 Manticore 健康狀態並更新指標的背景工作
+func newHealthWatcher(client manticore.ManticoreService) (microservice.ServiceHandler, error) {
+	if viper.GetString("metrics.path") == "" {
+		return nil, fmt.Errorf("metrics.path is empty")
+	}
+	interval := viper.GetDuration("metrics.health_interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("metrics.health_interval must be greater than zero")
+	}
+	return func(ctx context.Context) {
+		metrics.WatchHealth(ctx, client, interval)
+	}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
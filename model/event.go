@@ -0,0 +1,42 @@
+package model
+
+// SearchEventType 搜尋事件的種類
+type SearchEventType string
+
+const (
+	// SearchEventImpression 搜尋結果中出現了該 idea
+	SearchEventImpression SearchEventType = "impression"
+	// SearchEventClick 使用者從搜尋結果點擊了該 idea
+	SearchEventClick SearchEventType = "click"
+	// SearchEventBookmark 使用者從搜尋結果收藏了該 idea
+	SearchEventBookmark SearchEventType = "bookmark"
+)
+
+// SearchEvent 搜尋結果上的使用者互動事件
+type SearchEvent struct {
+	Type   SearchEventType `json:"type"`
+	Query  string          `json:"query"`
+	IdeaID uint64          `json:"idea_id"`
+	// Position 該 idea 在搜尋結果中的位置，從 1 開始
+	Position int32 `json:"position"`
+	// Timestamp 事件發生的 Unix 時間 (秒)
+	Timestamp int64 `json:"timestamp"`
+}
+
+// IdeaEventType idea 生命週期事件的種類
+type IdeaEventType string
+
+const (
+	// IdeaEventPublished 排程的 idea 到了 publish_at，開始出現在公開搜尋中
+	IdeaEventPublished IdeaEventType = "published"
+	// IdeaEventExpired idea 到了 expire_at，已改為 archived
+	IdeaEventExpired IdeaEventType = "expired"
+)
+
+// IdeaEvent idea 生命週期的事件
+type IdeaEvent struct {
+	Type   IdeaEventType `json:"type"`
+	IdeaID uint64        `json:"idea_id"`
+	// Timestamp 事件發生的 Unix 時間 (秒)
+	Timestamp int64 `json:"timestamp"`
+}
@@ -17,11 +17,33 @@ type IdeaData struct {
 	Tags               string  `json:"tags"`
 	Host_message       string  `json:"host_message"`
 	Experience_hours   float64 `json:"experience_hours"`
+	// Created_at 與 Updated_at 為 Unix 時間 (秒)
+	Created_at int64 `json:"created_at"`
+	Updated_at int64 `json:"updated_at"`
+	// View_count 與 Booking_count 為熱門度指標，用於排序
+	View_count    int64 `json:"view_count"`
+	Booking_count int64 `json:"booking_count"`
+	// Impression_count 與 Bookmark_count 由搜尋事件彙總而來
+	Impression_count int64 `json:"impression_count"`
+	Bookmark_count   int64 `json:"bookmark_count"`
+	// Deleted_at 移到資源回收筒的 Unix 時間 (秒)，0 表示未刪除
+	Deleted_at int64 `json:"deleted_at"`
+	// Status idea 的狀態，見 StatusDraft 等常數
+	Status string `json:"status"`
+	// Owner_id 建立者的使用者 ID，用於判斷是否可以編輯；不包含在 IdeaResponse 中，避免公開使用者 ID
+	Owner_id string `json:"owner_id"`
+	// Publish_at 與 Expire_at 公開搜尋顯示的期間 (Unix 秒)，0 表示不限制
+	Publish_at int64 `json:"publish_at"`
+	Expire_at  int64 `json:"expire_at"`
+	// Version 每次新增、更新或刪除時遞增，用於偵測同時編輯；熱門度彙總不改變版本
+	Version int64 `json:"version"`
+	// Embedding 由 Embedder 計算的語意向量，維度為 EmbeddingDims
+	Embedding []float32 `json:"embedding,omitempty"`
 }
 
 // ToMap 將 IdeaData 轉換為 map
 func (d *IdeaData) ToMap() map[string]interface{} {
-	return map[string]interface{}{
+	data := map[string]interface{}{
 		"id":                 d.ID,
 		"name":               d.Name,
 		"rewilding_name":     d.Rewilding_name,
@@ -30,6 +52,91 @@ func (d *IdeaData) ToMap() map[string]interface{} {
 		"tags":               d.Tags,
 		"host_message":       d.Host_message,
 		"experience_hours":   d.Experience_hours,
+		"created_at":         d.Created_at,
+		"updated_at":         d.Updated_at,
+		"view_count":         d.View_count,
+		"booking_count":      d.Booking_count,
+		"impression_count":   d.Impression_count,
+		"bookmark_count":     d.Bookmark_count,
+		"deleted_at":         d.Deleted_at,
+		"status":             d.Status,
+		"owner_id":           d.Owner_id,
+		"publish_at":         d.Publish_at,
+		"expire_at":          d.Expire_at,
+		"version":            d.Version,
+	}
+	if len(d.Embedding) > 0 {
+		data["embedding"] = d.Embedding
+	}
+	return data
+}
+
+// ETag 以 idea 的版本產生強驗證的 ETag。每次修改內容都會遞增版本，
+// 背景彙總的熱門度指標不遞增版本，因此熱門度變動不會讓客戶端的 If-Match 失敗
+func (d *IdeaData) ETag() string {
+	return `"v` + strconv.FormatInt(d.Version, 10) + `"`
+}
+
+// Response 轉換為 API 回傳格式
+func (d *IdeaData) Response() IdeaResponse {
+	return IdeaResponse{
+		ID:                 d.ID,
+		Name:               d.Name,
+		RewildingName:      d.Rewilding_name,
+		RewildingMode:      d.Rewilding_mode,
+		RewildingLocation:  d.Rewilding_location,
+		HostMessage:        d.Host_message,
+		ExperienceDuration: d.Experience_hours,
+		Tags:               strings.Split(d.Tags, ","),
+		CreatedAt:          d.Created_at,
+		UpdatedAt:          d.Updated_at,
+		ViewCount:          d.View_count,
+		BookingCount:       d.Booking_count,
+		ImpressionCount:    d.Impression_count,
+		BookmarkCount:      d.Bookmark_count,
+		DeletedAt:          d.Deleted_at,
+		Status:             d.Status,
+		PublishAt:          d.Publish_at,
+		ExpireAt:           d.Expire_at,
+		Version:            d.Version,
+	}
+}
+
+// EmbeddingText 回傳用於計算語意向量的文字
+func (d *IdeaData) EmbeddingText() string {
+	return strings.Join([]string{
+		d.Name,
+		d.Rewilding_name,
+		d.Rewilding_mode,
+		d.Rewilding_location,
+		strings.ReplaceAll(d.Tags, ",", " "),
+		d.Host_message,
+	}, " ")
+}
+
+// IdeaDataFromMap 將 Manticore 文件的 _source 轉換為 IdeaData
+func IdeaDataFromMap(id uint64, source map[string]interface{}) *IdeaData {
+	return &IdeaData{
+		ID:                 id,
+		Name:               getString(source, "name"),
+		Rewilding_name:     getString(source, "rewilding_name"),
+		Rewilding_mode:     getString(source, "rewilding_mode"),
+		Rewilding_location: getString(source, "rewilding_location"),
+		Tags:               getString(source, "tags"),
+		Host_message:       getString(source, "host_message"),
+		Experience_hours:   getFloat64(source, "experience_hours"),
+		Created_at:         getInt64(source, "created_at"),
+		Updated_at:         getInt64(source, "updated_at"),
+		View_count:         getInt64(source, "view_count"),
+		Booking_count:      getInt64(source, "booking_count"),
+		Impression_count:   getInt64(source, "impression_count"),
+		Bookmark_count:     getInt64(source, "bookmark_count"),
+		Deleted_at:         getInt64(source, "deleted_at"),
+		Status:             getString(source, "status"),
+		Owner_id:           getString(source, "owner_id"),
+		Publish_at:         getInt64(source, "publish_at"),
+		Expire_at:          getInt64(source, "expire_at"),
+		Version:            getInt64(source, "version"),
 	}
 }
 
@@ -43,13 +150,40 @@ type IdeaResponse struct {
 	HostMessage        string   `json:"host_message"`
 	ExperienceDuration float64  `json:"experience_duration"`
 	Tags               []string `json:"tags"`
+	CreatedAt          int64    `json:"created_at"`
+	UpdatedAt          int64    `json:"updated_at"`
+	ViewCount          int64    `json:"view_count"`
+	BookingCount       int64    `json:"booking_count"`
+	ImpressionCount    int64    `json:"impression_count"`
+	BookmarkCount      int64    `json:"bookmark_count"`
+	// DeletedAt 只有資源回收筒中的 idea 不為 0
+	DeletedAt int64  `json:"deleted_at,omitempty"`
+	Status    string `json:"status"`
+	// PublishAt 與 ExpireAt 只有排程的 idea 不為 0
+	PublishAt int64 `json:"publish_at,omitempty"`
+	ExpireAt  int64 `json:"expire_at,omitempty"`
+	Version   int64 `json:"version"`
 }
 
 // SearchResponse 搜尋結果的回傳格式
 type SearchResponse struct {
-	Data   []IdeaResponse `json:"data"`
-	Total  int64          `json:"total"`
-	Scroll string         `json:"scroll"`
+	Data  []IdeaResponse `json:"data"`
+	Total int64          `json:"total"`
+	// Scroll 為 Manticore 原始的 scroll token，只供服務層產生游標使用，不回傳給客戶端
+	Scroll string `json:"-"`
+	// NextCursor 下一頁的分頁游標，沒有下一頁時為空
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	// Page 與 TotalPages 只在頁碼分頁時回傳
+	Page       int32 `json:"page,omitempty"`
+	TotalPages int64 `json:"total_pages,omitempty"`
+	// Suggestions 關鍵字搜尋沒有結果時提供的「您是不是要找」建議
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Corrected 表示結果是以 CorrectedKeyword 重新搜尋而來
+	Corrected        bool   `json:"corrected,omitempty"`
+	CorrectedKeyword string `json:"corrected_keyword,omitempty"`
+	// Fields 不為空時，data 只回傳這些欄位，見 MarshalJSON
+	Fields []string `json:"-"`
 }
 
 // FromManticoreResponse 從 Manticore 的搜尋結果轉換為 API 回傳格式
@@ -58,17 +192,7 @@ func FromManticoreResponse(result *manticoresearch.SearchResponse) *SearchRespon
 	if result != nil && result.Hits != nil && result.Hits.Hits != nil {
 		for _, hit := range result.Hits.Hits {
 			source := hit["_source"].(map[string]interface{})
-			idea := IdeaResponse{
-				ID:                 uint64(hit["_id"].(float64)),
-				Name:               getString(source, "name"),
-				RewildingName:      getString(source, "rewilding_name"),
-				RewildingMode:      getString(source, "rewilding_mode"),
-				RewildingLocation:  getString(source, "rewilding_location"),
-				HostMessage:        getString(source, "host_message"),
-				ExperienceDuration: getFloat64(source, "experience_hours"),
-				Tags:               strings.Split(getString(source, "tags"), ","),
-			}
-			ideas = append(ideas, idea)
+			ideas = append(ideas, IdeaDataFromMap(uint64(hit["_id"].(float64)), source).Response())
 		}
 	}
 
@@ -114,3 +238,21 @@ func getFloat64(data map[string]interface{}, key string) float64 {
 	}
 	return 0
 }
+
+func getInt64(data map[string]interface{}, key string) int64 {
+	if val, ok := data[key]; ok {
+		switch v := val.(type) {
+		case float64:
+			return int64(v)
+		case int64:
+			return v
+		case int:
+			return int64(v)
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ideaResponseFields 定義 IdeaResponse 可投影的欄位，對應到 Manticore 的欄位名稱。
+// id 為文件 ID，不在 _source 中。
+var ideaResponseFields = []struct {
+	name   string
+	source string
+}{
+	{"id", ""},
+	{"name", "name"},
+	{"rewilding_name", "rewilding_name"},
+	{"rewilding_mode", "rewilding_mode"},
+	{"rewilding_location", "rewilding_location"},
+	{"host_message", "host_message"},
+	{"experience_duration", "experience_hours"},
+	{"tags", "tags"},
+	{"created_at", "created_at"},
+	{"updated_at", "updated_at"},
+	{"view_count", "view_count"},
+	{"booking_count", "booking_count"},
+	{"impression_count", "impression_count"},
+	{"bookmark_count", "bookmark_count"},
+	{"deleted_at", "deleted_at"},
+	{"status", "status"},
+	{"publish_at", "publish_at"},
+	{"expire_at", "expire_at"},
+	{"version", "version"},
+}
+
+// Projection 描述搜尋結果要回傳的欄位
+type Projection struct {
+	// Fields 要回傳的 API 欄位，依 ideaResponseFields 的順序排列
+	Fields []string
+	// Includes 與 Excludes 為對應的 Manticore _source 欄位
+	Includes []string
+	Excludes []string
+}
+
+// NewProjection 解析 fields 參數。
+// 一般欄位名稱表示只回傳這些欄位，以 "-" 開頭的欄位表示排除該欄位；
+// 未知的欄位名稱會回傳錯誤。
+func NewProjection(fields []string) (*Projection, error) {
+	include := make(map[string]bool)
+	exclude := make(map[string]bool)
+	for _, field := range fields {
+		name := strings.TrimPrefix(field, "-")
+		if !isIdeaResponseField(name) {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+		if strings.HasPrefix(field, "-") {
+			exclude[name] = true
+		} else {
+			include[name] = true
+		}
+	}
+
+	projection := &Projection{}
+	for _, field := range ideaResponseFields {
+		if (len(include) > 0 && !include[field.name]) || exclude[field.name] {
+			if field.source != "" && len(include) == 0 {
+				projection.Excludes = append(projection.Excludes, field.source)
+			}
+			continue
+		}
+		projection.Fields = append(projection.Fields, field.name)
+		if field.source != "" && len(include) > 0 {
+			projection.Includes = append(projection.Includes, field.source)
+		}
+	}
+
+	// 只要求 id 時，排除所有 _source 欄位
+	if len(include) > 0 && len(projection.Includes) == 0 {
+		for _, field := range ideaResponseFields {
+			if field.source != "" {
+				projection.Excludes = append(projection.Excludes, field.source)
+			}
+		}
+	}
+	return projection, nil
+}
+
+func isIdeaResponseField(name string) bool {
+	for _, field := range ideaResponseFields {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON 設定了 Fields 時，data 只輸出指定的欄位
+func (r SearchResponse) MarshalJSON() ([]byte, error) {
+	type searchResponse SearchResponse
+	if len(r.Fields) == 0 {
+		return json.Marshal(searchResponse(r))
+	}
+
+	data := make([]map[string]interface{}, 0, len(r.Data))
+	for _, idea := range r.Data {
+		all := idea.toMap()
+		projected := make(map[string]interface{}, len(r.Fields))
+		for _, field := range r.Fields {
+			projected[field] = all[field]
+		}
+		data = append(data, projected)
+	}
+
+	return json.Marshal(struct {
+		searchResponse
+		Data []map[string]interface{} `json:"data"`
+	}{
+		searchResponse: searchResponse(r),
+		Data:           data,
+	})
+}
+
+// toMap 將 IdeaResponse 轉換為以 API 欄位名稱為鍵的 map
+func (r IdeaResponse) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"id":                  r.ID,
+		"name":                r.Name,
+		"rewilding_name":      r.RewildingName,
+		"rewilding_mode":      r.RewildingMode,
+		"rewilding_location":  r.RewildingLocation,
+		"host_message":        r.HostMessage,
+		"experience_duration": r.ExperienceDuration,
+		"tags":                r.Tags,
+		"created_at":          r.CreatedAt,
+		"updated_at":          r.UpdatedAt,
+		"view_count":          r.ViewCount,
+		"booking_count":       r.BookingCount,
+		"impression_count":    r.ImpressionCount,
+		"bookmark_count":      r.BookmarkCount,
+		"deleted_at":          r.DeletedAt,
+		"status":              r.Status,
+		"publish_at":          r.PublishAt,
+		"expire_at":           r.ExpireAt,
+		"version":             r.Version,
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmbeddingDims idea 表向量欄位 embedding 的維度
+const EmbeddingDims = 64
+
+// Column 定義 Manticore 表的欄位
+type Column struct {
+	Name string
+	// Type 為 CREATE TABLE 中的欄位型別與選項
+	Type string
+}
+
+// IdeaColumns 定義 idea 表的欄位，id 由 Manticore 自動建立
+var IdeaColumns = []Column{
+	{"name", "text"},
+	{"rewilding_name", "text"},
+	// 同時需要全文搜索與 EQUAL/IN 過濾的欄位
+	{"rewilding_mode", "string attribute indexed"},
+	{"rewilding_location", "string attribute indexed"},
+	{"tags", "text"},
+	{"host_message", "text"},
+	{"experience_hours", "float"},
+	{"created_at", "timestamp"},
+	{"updated_at", "timestamp"},
+	{"view_count", "bigint"},
+	{"booking_count", "bigint"},
+	{"impression_count", "bigint"},
+	{"bookmark_count", "bigint"},
+	{"deleted_at", "timestamp"},
+	{"status", "string"},
+	{"owner_id", "string"},
+	{"publish_at", "timestamp"},
+	{"expire_at", "timestamp"},
+	{"version", "bigint"},
+	{"embedding", fmt.Sprintf("float_vector knn_type='hnsw' knn_dims='%d' hnsw_similarity='cosine'", EmbeddingDims)},
+}
+
+// IdeaTableSchema 回傳建立 idea 表的 SQL。
+// min_infix_len 為 CALL SUGGEST 所需，icu_chinese 用於中文斷詞。
+func IdeaTableSchema(table string) string {
+	columns := make([]string, 0, len(IdeaColumns))
+	for _, column := range IdeaColumns {
+		columns = append(columns, fmt.Sprintf("  %s %s", column.Name, column.Type))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n) charset_table='non_cont' morphology='icu_chinese' min_infix_len='2'",
+		table, strings.Join(columns, ",\n"))
+}
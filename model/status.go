@@ -0,0 +1,26 @@
+package model
+
+// idea 的狀態，狀態之間的轉換由 service 層檢查
+const (
+	// StatusDraft 草稿，只有建立者與管理者看得到
+	StatusDraft = "draft"
+	// StatusPendingReview 已送出，等待管理者審核
+	StatusPendingReview = "pending_review"
+	// StatusPublished 已發布，公開搜尋只回傳此狀態的 idea
+	StatusPublished = "published"
+	// StatusArchived 已下架
+	StatusArchived = "archived"
+)
+
+// Statuses 所有 idea 的狀態
+var Statuses = []string{StatusDraft, StatusPendingReview, StatusPublished, StatusArchived}
+
+// IsValidStatus 判斷 status 是否為已定義的狀態
+func IsValidStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+// sign 以 signer 簽署標頭與 claims，回傳 JWT
+func sign(t *testing.T, h map[string]interface{}, claims map[string]interface{}, signer func(signed []byte) []byte) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		assert.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(h) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signer([]byte(signed)))
+}
+
+func hmacSigner(secret string) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "user-1",
+		"iss": "https://auth.example.com",
+		"aud": []string{"post", "other"},
+		"exp": testNow.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyHS256(t *testing.T) {
+	v, err := NewVerifier(Config{Algorithm: HS256, Secret: "secret", Issuer: "https://auth.example.com", Audience: "post", Leeway: time.Minute})
+	assert.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	hs256 := map[string]interface{}{"alg": HS256, "typ": "JWT"}
+
+	claims, err := v.Verify(sign(t, hs256, validClaims(), hmacSigner("secret")))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, []string{"post", "other"}, claims.Audience)
+	assert.Equal(t, "user-1", claims.Raw["sub"])
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		modify func(map[string]interface{})
+		secret string
+	}{
+		{name: "wrong secret", secret: "other"},
+		{name: "alg none", header: map[string]interface{}{"alg": "none"}},
+		{name: "expired", modify: func(c map[string]interface{}) { c["exp"] = testNow.Add(-2 * time.Minute).Unix() }},
+		{name: "missing exp", modify: func(c map[string]interface{}) { delete(c, "exp") }},
+		{name: "missing sub", modify: func(c map[string]interface{}) { delete(c, "sub") }},
+		{name: "not valid yet", modify: func(c map[string]interface{}) { c["nbf"] = testNow.Add(2 * time.Minute).Unix() }},
+		{name: "wrong issuer", modify: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", modify: func(c map[string]interface{}) { c["aud"] = "other" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := hs256
+			if test.header != nil {
+				h = test.header
+			}
+			claims := validClaims()
+			if test.modify != nil {
+				test.modify(claims)
+			}
+			secret := "secret"
+			if test.secret != "" {
+				secret = test.secret
+			}
+			_, err := v.Verify(sign(t, h, claims, hmacSigner(secret)))
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	// 容許 leeway 內的時鐘誤差
+	expired := validClaims()
+	expired["exp"] = testNow.Add(-30 * time.Second).Unix()
+	_, err = v.Verify(sign(t, hs256, expired, hmacSigner("secret")))
+	assert.NoError(t, err)
+
+	_, err = v.Verify("not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, jwks, 0o600))
+
+	v, err := NewVerifier(Config{Algorithm: RS256, JWKSPath: path, Audience: "post"})
+	assert.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	rsaSigner := func(key *rsa.PrivateKey) func([]byte) []byte {
+		return func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			assert.NoError(t, err)
+			return signature
+		}
+	}
+
+	claims, err := v.Verify(sign(t, map[string]interface{}{"alg": RS256, "kid": "key-1"}, validClaims(), rsaSigner(key)))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	// 只有一把金鑰時可省略 kid
+	_, err = v.Verify(sign(t, map[string]interface{}{"alg": RS256}, validClaims(), rsaSigner(key)))
+	assert.NoError(t, err)
+
+	_, err = v.Verify(sign(t, map[string]interface{}{"alg": RS256, "kid": "key-1"}, validClaims(), rsaSigner(other)))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = v.Verify(sign(t, map[string]interface{}{"alg": RS256, "kid": "key-2"}, validClaims(), rsaSigner(key)))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	// 不接受以公鑰作為 HS256 密鑰偽造的 token
+	_, err = v.Verify(sign(t, map[string]interface{}{"alg": HS256, "kid": "key-1"}, validClaims(), hmacSigner(string(key.N.Bytes()))))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, err := NewVerifier(Config{Algorithm: HS256})
+	assert.Error(t, err)
+	_, err = NewVerifier(Config{Algorithm: RS256})
+	assert.Error(t, err)
+	_, err = NewVerifier(Config{Algorithm: RS256, JWKSPath: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+	_, err = NewVerifier(Config{Algorithm: "none"})
+	assert.Error(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	token, err := BearerToken("Bearer abc.def.ghi")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc.def.ghi", token)
+	token, err = BearerToken("bearer  abc ")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", token)
+
+	for _, header := range []string{"", "Basic dXNlcg==", "Bearer", "Bearer "} {
+		_, err := BearerToken(header)
+		assert.ErrorIs(t, err, ErrMissingToken, header)
+	}
+}
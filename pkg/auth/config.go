@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// HS256 以共用密鑰簽章
+	HS256 = "HS256"
+	// RS256 以 RSA 私鑰簽章，公鑰從本機 JWKS 檔讀取
+	RS256 = "RS256"
+)
+
+// Config JWT 驗證的設定
+type Config struct {
+	// Algorithm 接受的簽章演算法，HS256 或 RS256，token 標頭的 alg 必須相同
+	Algorithm string `mapstructure:"algorithm"`
+	// Secret HS256 的共用密鑰
+	Secret string `mapstructure:"secret"`
+	// JWKSPath RS256 公鑰的 JWKS 檔
+	JWKSPath string `mapstructure:"jwks_path"`
+	// Issuer 不為空時 iss 必須相同
+	Issuer string `mapstructure:"issuer"`
+	// Audience 不為空時 aud 必須包含此值
+	Audience string `mapstructure:"audience"`
+	// Leeway 檢查 exp 與 nbf 時容許的時鐘誤差
+	Leeway time.Duration `mapstructure:"leeway"`
+}
+
+// LoadConfig 讀取 auth 設定
+func LoadConfig() (Config, error) {
+	var cfg Config
+	if err := viper.UnmarshalKey("auth", &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid auth config: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingToken 請求沒有帶 Bearer token
+	ErrMissingToken = errors.New("missing bearer token")
+	// ErrInvalidToken token 格式、簽章或 claims 不正確
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims 驗證通過的 JWT claims
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	// Raw 完整的 claims，供讀取角色等自訂欄位
+	Raw map[string]interface{}
+}
+
+// Verifier 依 Config 驗證 JWT
+type Verifier struct {
+	cfg Config
+	// keys RS256 以 kid 索引的公鑰
+	keys map[string]*rsa.PublicKey
+	now  func() time.Time
+}
+
+// NewVerifier 依設定創建 Verifier，RS256 時讀取 JWKS 檔
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{cfg: cfg, now: time.Now}
+	switch cfg.Algorithm {
+	case HS256:
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("auth.secret is required for %s", HS256)
+		}
+	case RS256:
+		if cfg.JWKSPath == "" {
+			return nil, fmt.Errorf("auth.jwks_path is required for %s", RS256)
+		}
+		keys, err := loadJWKS(cfg.JWKSPath)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	default:
+		return nil, fmt.Errorf("unsupported auth.algorithm: %q", cfg.Algorithm)
+	}
+	if cfg.Leeway < 0 {
+		return nil, fmt.Errorf("auth.leeway must not be negative")
+	}
+	return v, nil
+}
+
+// header JWT 標頭
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verify 驗證 token 的簽章、sub、exp、nbf、iss 與 aud，並回傳 claims；錯誤都包裝 ErrInvalidToken
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidToken, err)
+	}
+	// 只接受設定的演算法，避免以 none 或 HS256 偽造 RS256 的 token
+	if h.Algorithm != v.cfg.Algorithm {
+		return nil, fmt.Errorf("%w: unexpected alg %q", ErrInvalidToken, h.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %s", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("%w: claims: %s", ErrInvalidToken, err)
+	}
+	return v.validateClaims(raw)
+}
+
+// verifySignature 依演算法驗證簽章
+func (v *Verifier) verifySignature(h header, signed string, signature []byte) error {
+	switch h.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, []byte(v.cfg.Secret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case RS256:
+		key, err := v.key(h.KeyID)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	}
+	return nil
+}
+
+// key 依 kid 取得公鑰，token 沒有 kid 時只在 JWKS 僅有一把金鑰時使用該金鑰
+func (v *Verifier) key(kid string) (*rsa.PublicKey, error) {
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown kid %q", ErrInvalidToken, kid)
+}
+
+// validateClaims 檢查時間、iss 與 aud；sub 與 exp 為必要欄位，沒有 sub 的 token 無法識別使用者
+func (v *Verifier) validateClaims(raw map[string]interface{}) (*Claims, error) {
+	now := v.now()
+	exp, ok := numericDate(raw["exp"])
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(exp.Add(v.cfg.Leeway)) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericDate(raw["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+
+	claims := &Claims{ExpiresAt: exp, Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	claims.Issuer, _ = raw["iss"].(string)
+	switch aud := raw["aud"].(type) {
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				claims.Audience = append(claims.Audience, s)
+			}
+		}
+	}
+
+	if v.cfg.Issuer != "" && claims.Issuer != v.cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected iss %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.cfg.Audience != "" && !contains(claims.Audience, v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: audience does not include %q", ErrInvalidToken, v.cfg.Audience)
+	}
+	return claims, nil
+}
+
+// BearerToken 取出 Authorization 標頭中的 Bearer token
+func BearerToken(authorization string) (string, error) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// decodeSegment 解碼 base64url 編碼的 JSON
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate 解析 JWT 的 NumericDate (Unix 秒)
+func numericDate(value interface{}) (time.Time, bool) {
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
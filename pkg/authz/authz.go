@@ -0,0 +1,158 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// idea 的操作，也是設定檔 authz.roles.<角色> 的鍵
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	// ActionTransition 變更狀態的操作前綴，完整名稱為 transition_<目標狀態>，例如 transition_published
+	ActionTransition = "transition_"
+	// ActionSearchAll 以任意狀態搜尋 idea，不針對個別 idea，只有 any 範圍可以執行
+	ActionSearchAll = "search_all"
+	// ActionViewStats 查看搜尋統計，只有 any 範圍可以執行
+	ActionViewStats = "view_stats"
+	// ActionListTrash 列出所有使用者在資源回收筒中的 idea，沒有權限時只列出自己的 idea
+	ActionListTrash = "list_trash"
+)
+
+// 預設的管理角色
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	// ScopeOwn 只能操作自己擁有的 idea
+	ScopeOwn = "own"
+	// ScopeAny 可以操作任何 idea
+	ScopeAny = "any"
+)
+
+// defaultRolesClaim 未設定 authz.roles_claim 時讀取角色的 claim
+const defaultRolesClaim = "roles"
+
+// ErrForbidden 沒有權限執行操作，詳細原因見 DeniedError
+var ErrForbidden = errors.New("forbidden")
+
+// DeniedError 表示 Principal 沒有權限執行 Action，Reason 說明原因
+type DeniedError struct {
+	Action string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrForbidden, e.Reason)
+}
+
+func (e *DeniedError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Principal 執行操作的使用者
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// Policy 以角色決定可執行的操作與範圍
+type Policy struct {
+	// roles 角色 -> 操作 -> 範圍
+	roles map[string]map[string]string
+	// RolesClaim JWT 中存放角色的 claim
+	RolesClaim string
+}
+
+// NewPolicy 以角色 -> 操作 -> 範圍 (own 或 any) 創建 Policy
+func NewPolicy(roles map[string]map[string]string) (*Policy, error) {
+	for role, actions := range roles {
+		for action, scope := range actions {
+			if scope != ScopeOwn && scope != ScopeAny {
+				return nil, fmt.Errorf("invalid scope %q for authz.roles.%s.%s: must be %s or %s", scope, role, action, ScopeOwn, ScopeAny)
+			}
+		}
+	}
+	return &Policy{roles: roles, RolesClaim: defaultRolesClaim}, nil
+}
+
+// AdminPolicy 未啟用 authz 時管理路由使用的 Policy，只允許 moderator 與 admin 執行管理操作
+func AdminPolicy() *Policy {
+	actions := map[string]string{ActionSearchAll: ScopeAny, ActionViewStats: ScopeAny, ActionListTrash: ScopeAny}
+	return &Policy{
+		roles:      map[string]map[string]string{RoleModerator: actions, RoleAdmin: actions},
+		RolesClaim: defaultRolesClaim,
+	}
+}
+
+// LoadPolicy 讀取 authz.roles 與 authz.roles_claim
+func LoadPolicy() (*Policy, error) {
+	var roles map[string]map[string]string
+	if err := viper.UnmarshalKey("authz.roles", &roles); err != nil {
+		return nil, fmt.Errorf("invalid authz.roles: %w", err)
+	}
+	policy, err := NewPolicy(roles)
+	if err != nil {
+		return nil, err
+	}
+	if claim := viper.GetString("authz.roles_claim"); claim != "" {
+		policy.RolesClaim = claim
+	}
+	return policy, nil
+}
+
+// Authorize 判斷 principal 是否可以對 ownerID 擁有的 idea 執行 action，
+// 任一角色允許即通過，否則回傳說明原因的 DeniedError；ownerID 為空表示沒有擁有者，只有 any 範圍可以操作
+func (p *Policy) Authorize(principal Principal, action string, ownerID string) error {
+	if principal.ID == "" {
+		return &DeniedError{Action: action, Reason: "missing user identity"}
+	}
+	ownOnly := make([]string, 0)
+	for _, role := range principal.Roles {
+		switch p.roles[role][action] {
+		case ScopeAny:
+			return nil
+		case ScopeOwn:
+			if ownerID != "" && ownerID == principal.ID {
+				return nil
+			}
+			ownOnly = append(ownOnly, role)
+		}
+	}
+	if len(ownOnly) > 0 {
+		sort.Strings(ownOnly)
+		return &DeniedError{
+			Action: action,
+			Reason: fmt.Sprintf("role %s may only %s own ideas", strings.Join(ownOnly, ", "), action),
+		}
+	}
+	return &DeniedError{
+		Action: action,
+		Reason: fmt.Sprintf("no role of [%s] permits %s", strings.Join(principal.Roles, ", "), action),
+	}
+}
+
+// RolesFromClaims 從 claims 的 RolesClaim 讀取角色，接受字串陣列或以空白、逗號分隔的字串
+func (p *Policy) RolesFromClaims(claims map[string]interface{}) []string {
+	switch value := claims[p.RolesClaim].(type) {
+	case []interface{}:
+		roles := make([]string, 0, len(value))
+		for _, role := range value {
+			if s, ok := role.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	case string:
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPolicy(t *testing.T) *Policy {
+	policy, err := NewPolicy(map[string]map[string]string{
+		"host": {
+			ActionCreate: ScopeOwn,
+			ActionUpdate: ScopeOwn,
+			ActionDelete: ScopeOwn,
+		},
+		"moderator": {
+			ActionUpdate:                   ScopeAny,
+			ActionTransition + "published": ScopeAny,
+		},
+		"admin": {
+			ActionCreate: ScopeAny,
+			ActionUpdate: ScopeAny,
+			ActionDelete: ScopeAny,
+		},
+	})
+	assert.NoError(t, err)
+	return policy
+}
+
+func TestAuthorize(t *testing.T) {
+	policy := testPolicy(t)
+	host := Principal{ID: "host-1", Roles: []string{"host"}}
+
+	assert.NoError(t, policy.Authorize(host, ActionUpdate, "host-1"))
+	assert.NoError(t, policy.Authorize(Principal{ID: "admin-1", Roles: []string{"admin"}}, ActionDelete, "host-1"))
+	assert.NoError(t, policy.Authorize(Principal{ID: "mod-1", Roles: []string{"host", "moderator"}}, ActionUpdate, "host-1"))
+	assert.NoError(t, policy.Authorize(Principal{ID: "mod-1", Roles: []string{"moderator"}}, ActionTransition+"published", "host-1"))
+
+	err := policy.Authorize(host, ActionUpdate, "host-2")
+	assert.ErrorIs(t, err, ErrForbidden)
+	var denied *DeniedError
+	assert.ErrorAs(t, err, &denied)
+	assert.Equal(t, "role host may only update own ideas", denied.Reason)
+
+	// 沒有擁有者的 idea 只有 any 範圍可以操作
+	assert.ErrorIs(t, policy.Authorize(host, ActionUpdate, ""), ErrForbidden)
+
+	err = policy.Authorize(Principal{ID: "mod-1", Roles: []string{"moderator"}}, ActionDelete, "host-1")
+	assert.ErrorAs(t, err, &denied)
+	assert.Equal(t, "no role of [moderator] permits delete", denied.Reason)
+
+	err = policy.Authorize(Principal{Roles: []string{"admin"}}, ActionDelete, "host-1")
+	assert.ErrorAs(t, err, &denied)
+	assert.Equal(t, "missing user identity", denied.Reason)
+}
+
+func TestNewPolicy(t *testing.T) {
+	_, err := NewPolicy(map[string]map[string]string{"host": {ActionUpdate: "all"}})
+	assert.Error(t, err)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	defer viper.Set("authz", nil)
+	viper.Set("authz", map[string]interface{}{
+		"roles_claim": "groups",
+		"roles": map[string]interface{}{
+			"host": map[string]interface{}{"update": "own"},
+		},
+	})
+
+	policy, err := LoadPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, "groups", policy.RolesClaim)
+	assert.NoError(t, policy.Authorize(Principal{ID: "host-1", Roles: []string{"host"}}, ActionUpdate, "host-1"))
+}
+
+func TestRolesFromClaims(t *testing.T) {
+	policy := testPolicy(t)
+	assert.Equal(t, []string{"host", "admin"}, policy.RolesFromClaims(map[string]interface{}{
+		"roles": []interface{}{"host", "admin", 1},
+	}))
+	assert.Equal(t, []string{"host", "moderator"}, policy.RolesFromClaims(map[string]interface{}{"roles": "host, moderator"}))
+	assert.Empty(t, policy.RolesFromClaims(map[string]interface{}{}))
+}
+
+func TestAdminPolicy(t *testing.T) {
+	policy := AdminPolicy()
+	assert.NoError(t, policy.Authorize(Principal{ID: "m", Roles: []string{RoleModerator}}, ActionSearchAll, ""))
+	assert.NoError(t, policy.Authorize(Principal{ID: "a", Roles: []string{"host", RoleAdmin}}, ActionSearchAll, ""))
+	assert.NoError(t, policy.Authorize(Principal{ID: "m", Roles: []string{RoleModerator}}, ActionViewStats, ""))
+	assert.NoError(t, policy.Authorize(Principal{ID: "m", Roles: []string{RoleModerator}}, ActionListTrash, ""))
+	assert.ErrorIs(t, policy.Authorize(Principal{ID: "h", Roles: []string{"host"}}, ActionSearchAll, ""), ErrForbidden)
+	assert.ErrorIs(t, policy.Authorize(Principal{ID: "h", Roles: []string{"host"}}, ActionViewStats, ""), ErrForbidden)
+	// 只涵蓋管理操作
+	assert.ErrorIs(t, policy.Authorize(Principal{ID: "a", Roles: []string{RoleAdmin}}, ActionUpdate, "h"), ErrForbidden)
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Backend 儲存快取項目的後端。
+// 預設為行程內的 LRU，多個實例需要共用快取時可改以 Redis 等外部儲存實作。
+type Backend interface {
+	// Get 取得 key 的值，不存在或已過期時 ok 為 false
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Set 儲存 key 的值，經過 ttl 後過期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Clear 移除所有項目
+	Clear(ctx context.Context) error
+}
+
+// entry LRU 中的一個項目
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRU 行程內的快取，超過容量時移除最久未使用的項目
+type LRU struct {
+	capacity int
+	now      func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	// order 最近使用的項目在前
+	order *list.List
+}
+
+// NewLRU 創建最多保存 capacity 個項目的 LRU
+func NewLRU(capacity int) (*LRU, error) {
+	if capacity <= 0 {
+		return nil, errors.New("cache capacity must be greater than zero")
+	}
+	return &LRU{
+		capacity: capacity,
+		now:      time.Now,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}, nil
+}
+
+// Get 實現 Backend，過期的項目在讀取時移除
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := element.Value.(*entry)
+	if !c.now().Before(item.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return item.value, true, nil
+}
+
+// Set 實現 Backend
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*entry)
+		item.value = value
+		item.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Clear 實現 Backend
+func (c *LRU) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element, c.capacity)
+	c.order.Init()
+	return nil
+}
+
+// Len 回傳目前的項目數，包含尚未移除的過期項目
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry).key)
+}
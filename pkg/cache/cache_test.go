@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru, err := NewLRU(2)
+	assert.NoError(t, err)
+
+	assert.NoError(t, lru.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.NoError(t, lru.Set(ctx, "b", []byte("2"), time.Minute))
+	// 讀取 a 後 b 成為最久未使用的項目
+	value, ok, err := lru.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.NoError(t, lru.Set(ctx, "c", []byte("3"), time.Minute))
+	_, ok, _ = lru.Get(ctx, "b")
+	assert.False(t, ok)
+	_, ok, _ = lru.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, lru.Len())
+
+	assert.NoError(t, lru.Clear(ctx))
+	_, ok, _ = lru.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+
+	_, err = NewLRU(0)
+	assert.Error(t, err)
+}
+
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	lru, _ := NewLRU(10)
+	lru.now = func() time.Time { return now }
+
+	assert.NoError(t, lru.Set(ctx, "a", []byte("1"), time.Minute))
+	now = now.Add(59 * time.Second)
+	_, ok, _ := lru.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok, _ = lru.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+}
@@ -0,0 +1,10 @@
+package embedding
+
+// Embedder 將文字轉換為固定維度的向量，用於 Manticore 的 KNN 搜尋
+type Embedder interface {
+	// Embed 計算文字的向量
+	Embed(text string) ([]float32, error)
+
+	// Dims 回傳向量的維度，需與 idea 表 float_vector 欄位的 knn_dims 相同
+	Dims() int
+}
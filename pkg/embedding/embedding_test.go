@@ -0,0 +1,54 @@
+package embedding
+
+import (
+	"math"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	dot := 0.0
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestHashEmbedder(t *testing.T) {
+	if _, err := NewHashEmbedder(0); err == nil {
+		t.Errorf("Expected non-nil error, got nil")
+	}
+
+	embedder, err := NewHashEmbedder(64)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if embedder.Dims() != 64 {
+		t.Errorf("Expected 64 dims, got %d", embedder.Dims())
+	}
+
+	a, _ := embedder.Embed("親子登山 Hiking")
+	b, _ := embedder.Embed("親子登山 Hiking")
+	if len(a) != 64 {
+		t.Fatalf("Expected vector of 64 dims, got %d", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Expected deterministic vectors, got %v and %v", a, b)
+		}
+	}
+	if norm := cosine(a, a); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("Expected unit vector, got norm %f", norm)
+	}
+
+	// 共用字詞的文字應比無關的文字更相近
+	related, _ := embedder.Embed("帶小孩去山上登山")
+	unrelated, _ := embedder.Embed("城市夜景咖啡")
+	if cosine(a, related) <= cosine(a, unrelated) {
+		t.Errorf("Expected related text to be closer, got %f <= %f", cosine(a, related), cosine(a, unrelated))
+	}
+
+	empty, _ := embedder.Embed("  ")
+	if cosine(empty, empty) != 0 {
+		t.Errorf("Expected zero vector for empty text")
+	}
+}
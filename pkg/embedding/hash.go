@@ -0,0 +1,99 @@
+package embedding
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+type hashEmbedder struct {
+	dims int
+}
+
+// NewHashEmbedder 創建以特徵雜湊 (feature hashing) 計算向量的 Embedder。
+// 中文以單字與相鄰兩字為特徵，其他文字以小寫單字為特徵，
+// 不需要外部模型或網路，相同的文字永遠得到相同的向量，適合本機開發與測試。
+func NewHashEmbedder(dims int) (Embedder, error) {
+	if dims <= 0 {
+		return nil, errors.New("dims must be greater than zero")
+	}
+	return &hashEmbedder{dims: dims}, nil
+}
+
+// Dims 實現 Embedder
+func (e *hashEmbedder) Dims() int {
+	return e.dims
+}
+
+// Embed 實現 Embedder，回傳經 L2 正規化的向量，沒有任何特徵時回傳零向量
+func (e *hashEmbedder) Embed(text string) ([]float32, error) {
+	vector := make([]float64, e.dims)
+	for _, feature := range features(text) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		// 以雜湊值的最高位元決定正負號，降低碰撞造成的偏差
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1.0
+		}
+		vector[sum%uint64(e.dims)] += sign
+	}
+
+	norm := 0.0
+	for _, v := range vector {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	result := make([]float32, e.dims)
+	if norm == 0 {
+		return result, nil
+	}
+	for i, v := range vector {
+		result[i] = float32(v / norm)
+	}
+	return result, nil
+}
+
+// features 將文字切成特徵
+func features(text string) []string {
+	result := make([]string, 0)
+	var han []rune
+	flushHan := func() {
+		for i, r := range han {
+			result = append(result, string(r))
+			if i > 0 {
+				result = append(result, string(han[i-1:i+1]))
+			}
+		}
+		han = han[:0]
+	}
+
+	var word strings.Builder
+	flushWord := func() {
+		if word.Len() > 0 {
+			result = append(result, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word.WriteRune(r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return result
+}
@@ -0,0 +1,152 @@
+package eventlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store 是只能附加的本機事件紀錄，每筆紀錄以一行 JSON 寫入檔案。
+// Append 先將紀錄放入緩衝區，累積到 batchSize 筆或經過 flushInterval 後才批次寫入，
+// 程序異常結束時，尚未寫入的紀錄會遺失。
+type Store struct {
+	path          string
+	batchSize     int
+	flushInterval time.Duration
+
+	mu     sync.Mutex
+	buffer [][]byte
+}
+
+// NewStore 創建事件紀錄，path 所在的目錄必須存在
+func NewStore(path string, batchSize int, flushInterval time.Duration) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+	if batchSize <= 0 {
+		return nil, errors.New("batch size must be greater than zero")
+	}
+	if flushInterval <= 0 {
+		return nil, errors.New("flush interval must be greater than zero")
+	}
+	// 確認檔案可以寫入
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open event log failed: %w", err)
+	}
+	file.Close()
+
+	return &Store{
+		path:          path,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+	}, nil
+}
+
+// Path 回傳事件紀錄的檔案路徑
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append 附加紀錄，緩衝區達到 batchSize 筆時立即寫入
+func (s *Store) Append(records ...interface{}) error {
+	lines := make([][]byte, 0, len(records))
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("encode event failed: %w", err)
+		}
+		lines = append(lines, line)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = append(s.buffer, lines...)
+	if len(s.buffer) >= s.batchSize {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+// Flush 將緩衝區的紀錄寫入檔案
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *Store) flushLocked() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open event log failed: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, line := range s.buffer {
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write event log failed: %w", err)
+	}
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+// Run 每隔 flushInterval 寫入一次緩衝區，ctx 結束時寫入剩餘的紀錄後返回。
+// 寫入失敗的紀錄保留在緩衝區，於下次寫入時重試，onError 可為 nil。
+func (s *Store) Run(ctx context.Context, onError func(error)) error {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return s.Flush()
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// ReadFrom 從檔案的 offset 位置開始，依序以每一行完整的紀錄呼叫 fn，
+// 回傳最後一筆已處理紀錄之後的位置，作為下次讀取的 offset。
+// fn 回傳錯誤時停止讀取，回傳的位置不包含該筆紀錄。
+func (s *Store) ReadFrom(offset int64, fn func(line []byte) error) (int64, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return offset, fmt.Errorf("open event log failed: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("seek event log failed: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// 不完整的最後一行留待下次讀取
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("read event log failed: %w", err)
+		}
+		if err := fn(line[:len(line)-1]); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
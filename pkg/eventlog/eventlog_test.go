@@ -0,0 +1,92 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	ID int `json:"id"`
+}
+
+func readAll(t *testing.T, store *Store, offset int64) ([]int, int64) {
+	ids := make([]int, 0)
+	next, err := store.ReadFrom(offset, func(line []byte) error {
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		ids = append(ids, r.ID)
+		return nil
+	})
+	assert.NoError(t, err)
+	return ids, next
+}
+
+func TestNewStore(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewStore("", 10, time.Second)
+	assert.Error(t, err)
+	_, err = NewStore(filepath.Join(dir, "events.log"), 0, time.Second)
+	assert.Error(t, err)
+	_, err = NewStore(filepath.Join(dir, "events.log"), 10, 0)
+	assert.Error(t, err)
+	_, err = NewStore(filepath.Join(dir, "missing", "events.log"), 10, time.Second)
+	assert.Error(t, err)
+}
+
+func TestStoreBatching(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "events.log"), 3, time.Hour)
+	assert.NoError(t, err)
+
+	// 未達批次筆數前不寫入
+	assert.NoError(t, store.Append(record{1}, record{2}))
+	ids, offset := readAll(t, store, 0)
+	assert.Empty(t, ids)
+	assert.Equal(t, int64(0), offset)
+
+	assert.NoError(t, store.Append(record{3}))
+	ids, offset = readAll(t, store, 0)
+	assert.Equal(t, []int{1, 2, 3}, ids)
+
+	// 從上次的位置繼續讀取
+	assert.NoError(t, store.Append(record{4}))
+	assert.NoError(t, store.Flush())
+	ids, _ = readAll(t, store, offset)
+	assert.Equal(t, []int{4}, ids)
+}
+
+func TestStoreReadFromPartialLine(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "events.log"), 1, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Append(record{1}))
+
+	file, err := os.OpenFile(store.Path(), os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NoError(t, err)
+	file.WriteString(`{"id":`)
+	file.Close()
+
+	ids, offset := readAll(t, store, 0)
+	assert.Equal(t, []int{1}, ids)
+	assert.Equal(t, int64(len(`{"id":1}`)+1), offset)
+}
+
+func TestStoreRunFlushesOnStop(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "events.log"), 100, time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Append(record{1}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, store.Run(ctx, nil))
+
+	ids, _ := readAll(t, store, 0)
+	assert.Equal(t, []int{1}, ids)
+}
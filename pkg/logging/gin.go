@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader 請求與回應中攜帶請求 ID 的標頭
+	RequestIDHeader = "X-Request-Id"
+	// maxRequestIDLength 接受上游請求 ID 的最大長度，超過時重新產生
+	maxRequestIDLength = 128
+)
+
+// GinHandler 為每個請求取得或產生請求 ID，放入 request context 與回應標頭，
+// 並在請求結束時寫入一筆包含路由、idea id、查詢條件與處理時間的紀錄。
+// skipPaths 中的路徑不寫入紀錄，例如健康檢查與指標。
+func GinHandler(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		if path != "" {
+			skip[path] = true
+		}
+	}
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if skip[route] {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String(KeyRoute, route),
+			slog.String(KeyMethod, c.Request.Method),
+			slog.Int(KeyStatus, c.Writer.Status()),
+			slog.Int64(KeyDuration, time.Since(start).Milliseconds()),
+		}
+		if ideaID := c.Param("id"); ideaID != "" {
+			attrs = append(attrs, slog.String(KeyIdeaID, ideaID))
+		}
+		if query := c.Query("query"); query != "" {
+			attrs = append(attrs, slog.String(KeyQuery, query))
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// validRequestID 只接受長度合理的可見 ASCII 字元，避免紀錄被注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 產生 32 個十六進位字元的隨機請求 ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
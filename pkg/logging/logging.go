@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 所有紀錄共用的欄位名稱
+const (
+	KeyRequestID = "request_id"
+	KeyTraceID   = "trace_id"
+	KeyRoute     = "route"
+	KeyMethod    = "method"
+	KeyStatus    = "status"
+	KeyIdeaID    = "idea_id"
+	KeyQuery     = "query"
+	KeyDuration  = "duration_ms"
+	KeyOperation = "operation"
+	KeyIndex     = "index"
+	KeyError     = "error"
+)
+
+// 支援的輸出位置
+const (
+	TargetOS   = "os"
+	TargetFile = "file"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID 將請求 ID 放入 ctx，之後以該 ctx 寫入的紀錄都會帶有 request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 取得 ctx 中的請求 ID，沒有時回傳空字串
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler 從 ctx 取出請求 ID 與 trace ID 加入每筆紀錄
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String(KeyTraceID, span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewHandler 創建輸出 JSON 的 slog.Handler，並自動加入 ctx 中的請求 ID 與 trace ID
+func NewHandler(w io.Writer, level slog.Level) slog.Handler {
+	return contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}
+}
+
+// Setup 依 log 設定建立 logger 並設為 slog 與標準 log 套件的預設值。
+// log.level 為 debug、info、warn 或 error；log.target 為 os (標準輸出) 或 file (寫入 log.file)。
+// 回傳的函式用於關閉紀錄檔。
+func Setup() (func() error, error) {
+	level, err := parseLevel(viper.GetString("log.level"))
+	if err != nil {
+		return nil, err
+	}
+
+	var writer io.Writer
+	closer := func() error { return nil }
+	switch target := viper.GetString("log.target"); target {
+	case "", TargetOS:
+		writer = os.Stdout
+	case TargetFile:
+		path := viper.GetString("log.file")
+		if path == "" {
+			return nil, fmt.Errorf("log.file is empty")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open log file failed: %w", err)
+		}
+		writer, closer = file, file.Close
+	default:
+		return nil, fmt.Errorf("unknown log.target: %s", target)
+	}
+
+	slog.SetDefault(slog.New(NewHandler(writer, level)))
+	return closer, nil
+}
+
+// parseLevel 解析紀錄等級，未設定時為 info
+func parseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log.level: %s", value)
+	}
+}
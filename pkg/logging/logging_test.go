@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/gin-gonic/gin"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs 將預設 logger 換成寫入緩衝區的 logger，並回傳解析紀錄的函式
+func captureLogs(t *testing.T) func() []map[string]interface{} {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	buf := &bytes.Buffer{}
+	slog.SetDefault(slog.New(NewHandler(buf, slog.LevelDebug)))
+	return func() []map[string]interface{} {
+		records := make([]map[string]interface{}, 0)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &record))
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+// failingManticore 所有呼叫都回傳 err
+type failingManticore struct {
+	manticore.ManticoreService
+	err error
+}
+
+func (f *failingManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	return nil, f.err
+}
+
+func (f *failingManticore) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
+	return nil, f.err
+}
+
+func TestSetup(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+	defer viper.Reset()
+
+	viper.Set("log.level", "verbose")
+	_, err := Setup()
+	assert.Error(t, err)
+
+	viper.Set("log.level", "warn")
+	viper.Set("log.target", "syslog")
+	_, err = Setup()
+	assert.Error(t, err)
+
+	viper.Set("log.target", TargetOS)
+	closer, err := Setup()
+	assert.NoError(t, err)
+	assert.NoError(t, closer())
+	assert.False(t, slog.Default().Enabled(context.Background(), slog.LevelInfo))
+	assert.True(t, slog.Default().Enabled(context.Background(), slog.LevelWarn))
+}
+
+func TestGinHandler(t *testing.T) {
+	records := captureLogs(t)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(GinHandler("/metrics"))
+	var requestID string
+	engine.GET("/idea/:id", func(c *gin.Context) {
+		requestID = RequestID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+	engine.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// 沿用上游的請求 ID
+	req := httptest.NewRequest("GET", "/idea/7?query=keyword%3D露營", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, "abc-123", requestID)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+
+	// 不合法的請求 ID 重新產生
+	req = httptest.NewRequest("GET", "/idea/8", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Len(t, requestID, 32)
+	assert.Equal(t, requestID, w.Header().Get(RequestIDHeader))
+
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+	logs := records()
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "request", logs[0]["msg"])
+	assert.Equal(t, "abc-123", logs[0][KeyRequestID])
+	assert.Equal(t, "/idea/:id", logs[0][KeyRoute])
+	assert.Equal(t, "7", logs[0][KeyIdeaID])
+	assert.Equal(t, "keyword=露營", logs[0][KeyQuery])
+	assert.Equal(t, float64(http.StatusNoContent), logs[0][KeyStatus])
+	assert.Contains(t, logs[0], KeyDuration)
+	assert.Equal(t, requestID, logs[1][KeyRequestID])
+	assert.NotContains(t, logs[1], KeyQuery)
+}
+
+func TestManticoreLogging(t *testing.T) {
+	records := captureLogs(t)
+
+	stub := &failingManticore{err: manticore.ErrDocumentNotFound}
+	client := Manticore(stub)
+	ctx := WithRequestID(context.Background(), "req-1")
+
+	// 找不到文件不記錄
+	_, err := client.Read(ctx, "idea", 1)
+	assert.ErrorIs(t, err, manticore.ErrDocumentNotFound)
+	assert.Empty(t, records())
+
+	stub.err = errors.New("connection refused")
+	_, err = client.Search(ctx, Manticoresearch.NewSearchRequest("idea"))
+	assert.Error(t, err)
+
+	logs := records()
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "ERROR", logs[0]["level"])
+	assert.Equal(t, "req-1", logs[0][KeyRequestID])
+	assert.Equal(t, "search", logs[0][KeyOperation])
+	assert.Equal(t, "idea", logs[0][KeyIndex])
+	assert.Equal(t, "connection refused", logs[0][KeyError])
+}
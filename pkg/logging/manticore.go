@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+)
+
+// logged 記錄 ManticoreService 回傳的錯誤，上層不需再重複記錄同一個錯誤
+type logged struct {
+	next manticore.ManticoreService
+}
+
+// Manticore 包裝 ManticoreService，呼叫失敗時以呼叫的 ctx 寫入一筆錯誤紀錄。
+// 找不到文件屬於正常的查詢結果，不會記錄。
+func Manticore(next manticore.ManticoreService) manticore.ManticoreService {
+	return &logged{next: next}
+}
+
+// logError 寫入錯誤紀錄，attrs 為呼叫的參數
+func logError(ctx context.Context, operation string, err error, attrs ...slog.Attr) {
+	if err == nil || errors.Is(err, manticore.ErrDocumentNotFound) {
+		return
+	}
+	attrs = append(attrs, slog.String(KeyOperation, operation), slog.String(KeyError, err.Error()))
+	slog.LogAttrs(ctx, slog.LevelError, "manticore call failed", attrs...)
+}
+
+func (m *logged) Create(ctx context.Context, index string, data map[string]interface{}) (int64, error) {
+	id, err := m.next.Create(ctx, index, data)
+	logError(ctx, "create", err, slog.String(KeyIndex, index))
+	return id, err
+}
+
+func (m *logged) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	source, err := m.next.Read(ctx, index, id)
+	logError(ctx, "read", err, slog.String(KeyIndex, index), slog.Int64(KeyIdeaID, id))
+	return source, err
+}
+
+func (m *logged) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	err := m.next.Replace(ctx, index, id, data)
+	logError(ctx, "replace", err, slog.String(KeyIndex, index), slog.Int64(KeyIdeaID, id))
+	return err
+}
+
+func (m *logged) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	err := m.next.Update(ctx, index, id, data)
+	logError(ctx, "update", err, slog.String(KeyIndex, index), slog.Int64(KeyIdeaID, id))
+	return err
+}
+
+func (m *logged) Delete(ctx context.Context, index string, id int64) error {
+	err := m.next.Delete(ctx, index, id)
+	logError(ctx, "delete", err, slog.String(KeyIndex, index), slog.Int64(KeyIdeaID, id))
+	return err
+}
+
+func (m *logged) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
+	response, err := m.next.Search(ctx, searchRequest)
+	logError(ctx, "search", err, slog.String(KeyIndex, searchRequest.Table))
+	return response, err
+}
+
+func (m *logged) Suggest(ctx context.Context, index string, word string, limit int) ([]string, error) {
+	suggestions, err := m.next.Suggest(ctx, index, word, limit)
+	logError(ctx, "suggest", err, slog.String(KeyIndex, index), slog.String(KeyQuery, word))
+	return suggestions, err
+}
+
+func (m *logged) Health(ctx context.Context) (bool, error) {
+	ok, err := m.next.Health(ctx)
+	logError(ctx, "health", err)
+	return ok, err
+}
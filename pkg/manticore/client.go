@@ -2,39 +2,55 @@ package manticore
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"net/http"
 
 	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type manticore struct {
 	apiClient *Manticoresearch.APIClient
 }
 
-// NewManticore 創建新的 Manticore Search 客戶端
+// NewManticore 創建新的 Manticore Search 客戶端，
+// 設定 manticore.nodes 或 manticore.cluster 時回傳依節點角色分流的 client
 func NewManticore() (ManticoreService, error) {
-	// 創建配置
-	url := viper.GetString("manticore.url")
-	if url == "" {
-		return nil, errors.New("manticore.url is empty")
+	nodes, err := loadNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 1 && nodes[0].Role == RoleWrite && viper.GetString("manticore.cluster") == "" {
+		return newClient(nodes[0].URL), nil
+	}
+	client, err := newCluster(nodes)
+	if err != nil {
+		return nil, err
 	}
+	return client, nil
+}
+
+// newClient 創建連線到 url 的 client
+func newClient(url string) *manticore {
+	// 創建配置
 	configuration := Manticoresearch.NewConfiguration()
 	configuration.Servers[0].URL = url
-	// allow custom http client for advanced usage
+	// 以 otelhttp 包裝的 transport 為每次呼叫建立 span，並以 W3C trace context 傳遞給 Manticore
+	configuration.HTTPClient = &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
 	apiClient := Manticoresearch.NewAPIClient(configuration)
 
 	manticore := &manticore{
 		apiClient: apiClient,
 	}
-	return manticore, nil
+	return manticore
 }
 
 // Health 實現健康檢查
-func (c *manticore) Health() (bool, error) {
+func (c *manticore) Health(ctx context.Context) (bool, error) {
 	// 使用 SQL 查詢來檢查服務是否正常運行
-	ctx := context.Background()
 	_, _, err := c.apiClient.UtilsAPI.Sql(ctx).Body("SHOW STATUS").Execute()
 	if err != nil {
 		return false, fmt.Errorf("health check failed: %w", err)
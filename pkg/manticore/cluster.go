@@ -0,0 +1,253 @@
+package manticore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
+)
+
+// 節點角色
+const (
+	// RoleWrite 接受 Create、Replace、Update、Delete 與 Read 的節點
+	RoleWrite = "write"
+	// RoleRead 只負責 Search 與 Suggest 的複本節點
+	RoleRead = "read"
+)
+
+// NodeConfig 為 manticore.nodes 中的一個節點
+type NodeConfig struct {
+	URL  string `mapstructure:"url"`
+	Role string `mapstructure:"role"`
+}
+
+// loadNodes 讀取 manticore.nodes，未設定時以 manticore.url 作為唯一的寫入節點
+func loadNodes() ([]NodeConfig, error) {
+	var nodes []NodeConfig
+	if err := viper.UnmarshalKey("manticore.nodes", &nodes); err != nil {
+		return nil, fmt.Errorf("invalid manticore.nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		url := viper.GetString("manticore.url")
+		if url == "" {
+			return nil, errors.New("manticore.url is empty")
+		}
+		return []NodeConfig{{URL: url, Role: RoleWrite}}, nil
+	}
+	for i, node := range nodes {
+		if node.URL == "" {
+			return nil, fmt.Errorf("manticore.nodes[%d].url is empty", i)
+		}
+		if node.Role != RoleWrite && node.Role != RoleRead {
+			return nil, fmt.Errorf("manticore.nodes[%d].role must be %q or %q, got %q", i, RoleWrite, RoleRead, node.Role)
+		}
+	}
+	return nodes, nil
+}
+
+// node 記錄單一節點的連續失敗次數與移出狀態
+type node struct {
+	url    string
+	client *manticore
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+func (n *node) available(now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !now.Before(n.ejectedUntil)
+}
+
+// record 記錄呼叫結果，連續 ejectAfter 次暫時性錯誤後移出 ejectFor；
+// 成功或非暫時性錯誤表示節點可以回應，重新計算
+func (n *node) record(err error, now time.Time, ejectAfter int, ejectFor time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !IsTemporary(err) {
+		n.failures = 0
+		n.ejectedUntil = time.Time{}
+		return
+	}
+	n.failures++
+	if n.failures >= ejectAfter {
+		n.failures = 0
+		n.ejectedUntil = now.Add(ejectFor)
+	}
+}
+
+// cluster 依節點角色分流的 ManticoreService：
+// 寫入送往寫入節點，設定複寫叢集時寫入 <cluster>:<table>，可由任一寫入節點接受；
+// Search 與 Suggest 輪流送往健康的讀取節點，失敗時改送下一個，沒有可用的讀取節點時改送寫入節點。
+type cluster struct {
+	writers []*node
+	readers []*node
+	// name 複寫叢集名稱，為空時只能有一個寫入節點
+	name       string
+	ejectAfter int
+	ejectFor   time.Duration
+	next       atomic.Uint64
+	now        func() time.Time
+}
+
+func newCluster(configs []NodeConfig) (*cluster, error) {
+	c := &cluster{
+		name:       viper.GetString("manticore.cluster"),
+		ejectAfter: viper.GetInt("manticore.eject_after"),
+		ejectFor:   viper.GetDuration("manticore.eject_duration"),
+		now:        time.Now,
+	}
+	if c.ejectAfter <= 0 {
+		c.ejectAfter = 1
+	}
+	if c.ejectFor <= 0 {
+		c.ejectFor = 30 * time.Second
+	}
+	for _, config := range configs {
+		n := &node{url: config.URL, client: newClient(config.URL)}
+		if config.Role == RoleWrite {
+			c.writers = append(c.writers, n)
+		} else {
+			c.readers = append(c.readers, n)
+		}
+	}
+	switch {
+	case len(c.writers) == 0:
+		return nil, errors.New("manticore.nodes must contain a write node")
+	case len(c.writers) > 1 && c.name == "":
+		return nil, errors.New("manticore.cluster is required for more than one write node")
+	}
+	return c, nil
+}
+
+// table 回傳寫入時使用的表名稱
+func (c *cluster) table(table string) string {
+	if c.name == "" {
+		return table
+	}
+	return c.name + ":" + table
+}
+
+// pick 回傳可用的節點，從 start 開始輪流排列；全部被移出時回傳所有節點，仍嘗試送出
+func (c *cluster) pick(nodes []*node, start int) []*node {
+	now := c.now()
+	picked := make([]*node, 0, len(nodes))
+	for i := range nodes {
+		n := nodes[(start+i)%len(nodes)]
+		if n.available(now) {
+			picked = append(picked, n)
+		}
+	}
+	return picked
+}
+
+// readNodes 回傳 Search 與 Suggest 依序嘗試的節點
+func (c *cluster) readNodes() []*node {
+	start := int(c.next.Add(1))
+	nodes := append(c.pick(c.readers, start), c.pick(c.writers, start)...)
+	if len(nodes) == 0 {
+		nodes = append(append(nodes, c.readers...), c.writers...)
+	}
+	return nodes
+}
+
+// writeNodes 回傳寫入依序嘗試的節點
+func (c *cluster) writeNodes() []*node {
+	nodes := c.pick(c.writers, 0)
+	if len(nodes) == 0 {
+		nodes = c.writers
+	}
+	return nodes
+}
+
+// do 依序在 nodes 上執行 fn，遇到暫時性錯誤時，failover 為 true 才改送下一個節點
+func (c *cluster) do(nodes []*node, failover bool, fn func(client *manticore) error) error {
+	var err error
+	for _, n := range nodes {
+		err = fn(n.client)
+		n.record(err, c.now(), c.ejectAfter, c.ejectFor)
+		if !failover || !IsTemporary(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Create 不改送其他節點，避免連線中斷但已寫入時重複建立文件
+func (c *cluster) Create(ctx context.Context, table string, data map[string]interface{}) (id int64, err error) {
+	err = c.do(c.writeNodes(), false, func(client *manticore) error {
+		id, err = client.Create(ctx, c.table(table), data)
+		return err
+	})
+	return id, err
+}
+
+// Read 讀取寫入節點，確保讀到剛寫入的內容
+func (c *cluster) Read(ctx context.Context, table string, id int64) (source map[string]interface{}, err error) {
+	err = c.do(c.writeNodes(), true, func(client *manticore) error {
+		source, err = client.Read(ctx, table, id)
+		return err
+	})
+	return source, err
+}
+
+func (c *cluster) Replace(ctx context.Context, table string, id int64, data map[string]interface{}) error {
+	return c.do(c.writeNodes(), true, func(client *manticore) error {
+		return client.Replace(ctx, c.table(table), id, data)
+	})
+}
+
+func (c *cluster) Update(ctx context.Context, table string, id int64, data map[string]interface{}) error {
+	return c.do(c.writeNodes(), true, func(client *manticore) error {
+		return client.Update(ctx, c.table(table), id, data)
+	})
+}
+
+func (c *cluster) Delete(ctx context.Context, table string, id int64) error {
+	return c.do(c.writeNodes(), true, func(client *manticore) error {
+		return client.Delete(ctx, c.table(table), id)
+	})
+}
+
+func (c *cluster) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (response *Manticoresearch.SearchResponse, err error) {
+	err = c.do(c.readNodes(), true, func(client *manticore) error {
+		response, err = client.Search(ctx, searchRequest)
+		return err
+	})
+	return response, err
+}
+
+func (c *cluster) Suggest(ctx context.Context, table string, word string, limit int) (suggestions []string, err error) {
+	err = c.do(c.readNodes(), true, func(client *manticore) error {
+		suggestions, err = client.Suggest(ctx, table, word, limit)
+		return err
+	})
+	return suggestions, err
+}
+
+// Health 檢查每個節點並更新移出狀態，恢復的節點重新加入；
+// 讀取節點全部失敗時改由寫入節點負責搜尋，因此只要有健康的寫入節點即視為健康
+func (c *cluster) Health(ctx context.Context) (bool, error) {
+	var errs []error
+	healthyWriters := 0
+	for i, n := range append(append([]*node{}, c.writers...), c.readers...) {
+		_, err := n.client.Health(ctx)
+		n.record(err, c.now(), c.ejectAfter, c.ejectFor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.url, err))
+		} else if i < len(c.writers) {
+			healthyWriters++
+		}
+	}
+	if healthyWriters > 0 {
+		return true, nil
+	}
+	return false, fmt.Errorf("no healthy write node: %w", errors.Join(errs...))
+}
@@ -8,17 +8,16 @@ import (
 )
 
 // Create 實現文件創建
-func (c *manticore) Create(table string, data map[string]interface{}) (int64, error) {
-	ctx := context.Background()
+func (c *manticore) Create(ctx context.Context, table string, data map[string]interface{}) (int64, error) {
 	req := Manticoresearch.NewInsertDocumentRequest(table, data)
 
 	successRes, httpRes, err := c.apiClient.IndexAPI.Insert(ctx).InsertDocumentRequest(*req).Execute()
 	if err != nil {
-		return 0, fmt.Errorf("create document failed: %w", err)
+		return 0, fmt.Errorf("create document failed: %w", withStatus(httpRes, err))
 	}
 
 	if httpRes.StatusCode != 200 {
-		return 0, fmt.Errorf("create document failed with status code: %d", httpRes.StatusCode)
+		return 0, fmt.Errorf("create document failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
 	}
 	if successRes != nil && successRes.Id != nil {
 		return *successRes.Id, nil
@@ -27,32 +26,36 @@ func (c *manticore) Create(table string, data map[string]interface{}) (int64, er
 	return 0, fmt.Errorf("failed to get document ID from response")
 }
 
-// Read 實現文件讀取
-/*func (c *manticore) Read(table string, id uint64) (*Document, error) {
-	ctx := context.Background()
+// Read 實現文件讀取，回傳文件的 _source，找不到時回傳 ErrDocumentNotFound
+func (c *manticore) Read(ctx context.Context, table string, id int64) (map[string]interface{}, error) {
 
-	// 使用 SQL 查詢來獲取文檔
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id = %d", table, id)
-	_, httpRes, err := c.apiClient.UtilsAPI.Sql(ctx).Body(query).Execute()
+	searchRequest := Manticoresearch.NewSearchRequest(table)
+	query := Manticoresearch.NewSearchQuery()
+	query.SetEquals(map[string]interface{}{"id": id})
+	searchRequest.SetQuery(*query)
+	searchRequest.SetLimit(1)
+
+	searchRes, httpRes, err := c.apiClient.SearchAPI.Search(ctx).SearchRequest(*searchRequest).Execute()
 	if err != nil {
-		return nil, fmt.Errorf("read document failed: %w", err)
+		return nil, fmt.Errorf("read document failed: %w", withStatus(httpRes, err))
 	}
 
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("read document failed with status code: %d", httpRes.StatusCode)
+		return nil, fmt.Errorf("read document failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
 	}
 
-	// TODO: 從響應中解析文檔
-	return &Document{
-		ID:    id,
-		Index: table,
-		Data:  make(map[string]interface{}),
-	}, nil
-}*/
+	if searchRes == nil || searchRes.Hits == nil || len(searchRes.Hits.Hits) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+	source, ok := searchRes.Hits.Hits[0]["_source"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("read document failed: unexpected _source")
+	}
+	return source, nil
+}
 
 // Replace 實現文件更新，如果文檔不存在，則創建新文檔，如果文檔存在，則更新文檔
-func (c *manticore) Replace(table string, id int64, data map[string]interface{}) error {
-	ctx := context.Background()
+func (c *manticore) Replace(ctx context.Context, table string, id int64, data map[string]interface{}) error {
 
 	req := Manticoresearch.NewInsertDocumentRequest(table, data)
 	req.SetId(id)
@@ -60,45 +63,60 @@ func (c *manticore) Replace(table string, id int64, data map[string]interface{})
 	// 執行 replace 操作
 	_, httpRes, err := c.apiClient.IndexAPI.Replace(ctx).InsertDocumentRequest(*req).Execute()
 	if err != nil {
-		return fmt.Errorf("replace document failed: %w", err)
+		return fmt.Errorf("replace document failed: %w", withStatus(httpRes, err))
+	}
+
+	if httpRes.StatusCode != 200 {
+		return fmt.Errorf("replace document failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
+	}
+
+	return nil
+}
+
+// Update 實現文件部分更新，只更新 data 中的屬性欄位
+func (c *manticore) Update(ctx context.Context, table string, id int64, data map[string]interface{}) error {
+	req := Manticoresearch.NewUpdateDocumentRequest(table, data)
+	req.SetId(id)
+
+	_, httpRes, err := c.apiClient.IndexAPI.Update(ctx).UpdateDocumentRequest(*req).Execute()
+	if err != nil {
+		return fmt.Errorf("update document failed: %w", withStatus(httpRes, err))
 	}
 
 	if httpRes.StatusCode != 200 {
-		return fmt.Errorf("replace document failed with status code: %d", httpRes.StatusCode)
+		return fmt.Errorf("update document failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
 	}
 
 	return nil
 }
 
 // Delete 實現文件刪除
-func (c *manticore) Delete(table string, id int64) error {
-	ctx := context.Background()
+func (c *manticore) Delete(ctx context.Context, table string, id int64) error {
 	req := Manticoresearch.NewDeleteDocumentRequest(table)
 	req.SetId(id)
 
 	_, httpRes, err := c.apiClient.IndexAPI.Delete(ctx).DeleteDocumentRequest(*req).Execute()
 	if err != nil {
-		return fmt.Errorf("delete document failed: %w", err)
+		return fmt.Errorf("delete document failed: %w", withStatus(httpRes, err))
 	}
 
 	if httpRes.StatusCode != 200 {
-		return fmt.Errorf("delete document failed with status code: %d", httpRes.StatusCode)
+		return fmt.Errorf("delete document failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
 	}
 
 	return nil
 }
 
 // Search 實現文件搜尋
-func (c *manticore) Search(searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
-	ctx := context.Background()
+func (c *manticore) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
 
 	searchRes, httpRes, err := c.apiClient.SearchAPI.Search(ctx).SearchRequest(*searchRequest).Execute()
 	if err != nil {
-		return nil, fmt.Errorf("search documents failed: %w", err)
+		return nil, fmt.Errorf("search documents failed: %w", withStatus(httpRes, err))
 	}
 
 	if httpRes.StatusCode != 200 {
-		return nil, fmt.Errorf("search documents failed with status code: %d", httpRes.StatusCode)
+		return nil, fmt.Errorf("search documents failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
 	}
 
 	return searchRes, nil
@@ -0,0 +1,54 @@
+package manticore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrQuery 表示 Manticore 拒絕了查詢，例如語法錯誤或表不存在，重試也不會成功
+var ErrQuery = errors.New("query error")
+
+// StatusError 表示 Manticore 回傳了非 200 的狀態碼
+type StatusError struct {
+	StatusCode int
+	// Err 為 client 回傳的原始錯誤，可能為 nil
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("status code: %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// withStatus 有 HTTP 回應時以 StatusError 包裝 client 回傳的錯誤
+func withStatus(httpRes *http.Response, err error) error {
+	if httpRes == nil {
+		return err
+	}
+	return &StatusError{StatusCode: httpRes.StatusCode, Err: err}
+}
+
+// IsTemporary 判斷錯誤是否可能在重試後成功：
+// 連線錯誤、5xx 與 429 為暫時性錯誤；找不到文件、查詢錯誤、其他 4xx 與呼叫端取消則不是。
+func IsTemporary(err error) bool {
+	if err == nil ||
+		errors.Is(err, ErrDocumentNotFound) ||
+		errors.Is(err, ErrQuery) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package manticore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Field 為 DESCRIBE 回傳的欄位定義
+type Field struct {
+	Name       string
+	Type       string
+	Properties string
+}
+
+// Inspector 查詢 Manticore 表與叢集的狀態，供健康檢查使用
+type Inspector interface {
+	// Describe 回傳表的欄位定義，表不存在時回傳錯誤
+	Describe(ctx context.Context, table string) ([]Field, error)
+
+	// TableStatus 回傳 SHOW TABLE STATUS 的結果，例如 indexed_documents
+	TableStatus(ctx context.Context, table string) (map[string]string, error)
+
+	// ReplicationStatus 回傳 SHOW STATUS 中叢集相關的計數器，未設定叢集時為空
+	ReplicationStatus(ctx context.Context) (map[string]string, error)
+}
+
+// NewInspector 創建查詢狀態用的 Manticore client，多節點時連線到第一個寫入節點
+func NewInspector() (Inspector, error) {
+	nodes, err := loadNodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.Role == RoleWrite {
+			return newClient(node.URL), nil
+		}
+	}
+	return newClient(nodes[0].URL), nil
+}
+
+// Describe 實現表欄位查詢
+func (c *manticore) Describe(ctx context.Context, table string) ([]Field, error) {
+	rows, err := c.sqlRows(ctx, "DESCRIBE "+table)
+	if err != nil {
+		return nil, fmt.Errorf("describe table failed: %w", err)
+	}
+	fields := make([]Field, 0, len(rows))
+	for _, row := range rows {
+		fields = append(fields, Field{
+			Name:       fmt.Sprint(row["Field"]),
+			Type:       fmt.Sprint(row["Type"]),
+			Properties: fmt.Sprint(row["Properties"]),
+		})
+	}
+	return fields, nil
+}
+
+// TableStatus 實現表狀態查詢
+func (c *manticore) TableStatus(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := c.sqlRows(ctx, fmt.Sprintf("SHOW TABLE %s STATUS", table))
+	if err != nil {
+		return nil, fmt.Errorf("show table status failed: %w", err)
+	}
+	return variables(rows, "Variable_name"), nil
+}
+
+// ReplicationStatus 實現叢集狀態查詢
+func (c *manticore) ReplicationStatus(ctx context.Context) (map[string]string, error) {
+	rows, err := c.sqlRows(ctx, "SHOW STATUS LIKE 'cluster%'")
+	if err != nil {
+		return nil, fmt.Errorf("show replication status failed: %w", err)
+	}
+	return variables(rows, "Counter"), nil
+}
+
+// variables 將名稱與值兩欄的資料列轉為 map
+func variables(rows []map[string]interface{}, nameColumn string) map[string]string {
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		name, ok := row[nameColumn].(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		values[name] = fmt.Sprint(row["Value"])
+	}
+	return values
+}
@@ -1,6 +1,14 @@
 package manticore
 
-import Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+import (
+	"context"
+	"errors"
+
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+)
+
+// ErrDocumentNotFound 表示指定 ID 的文件不存在
+var ErrDocumentNotFound = errors.New("document not found")
 
 // SearchResult 代表搜尋結果
 type SearchResult struct {
@@ -9,20 +17,30 @@ type SearchResult struct {
 	Scroll string                   `json:"scroll"`
 }
 
-// ManticoreService 定義了 Manticore Search 服務的基本介面
+// ManticoreService 定義了 Manticore Search 服務的基本介面，
+// ctx 用於取消請求與傳遞追蹤資訊
 type ManticoreService interface {
 	// Create 創建新文件
-	Create(index string, data map[string]interface{}) (int64, error)
+	Create(ctx context.Context, index string, data map[string]interface{}) (int64, error)
+
+	// Read 讀取文件
+	Read(ctx context.Context, index string, id int64) (map[string]interface{}, error)
 
 	// Replace 更新文件
-	Replace(index string, id int64, data map[string]interface{}) error
+	Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error
+
+	// Update 更新文件的部分屬性
+	Update(ctx context.Context, index string, id int64, data map[string]interface{}) error
 
 	// Delete 刪除文件
-	Delete(index string, id int64) error
+	Delete(ctx context.Context, index string, id int64) error
 
 	// Search 搜尋文件
-	Search(searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error)
+	Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error)
+
+	// Suggest 取得拼寫相近的建議詞
+	Suggest(ctx context.Context, index string, word string, limit int) ([]string, error)
 
 	// Health 健康檢查
-	Health() (bool, error)
+	Health(ctx context.Context) (bool, error)
 }
@@ -1,8 +1,16 @@
 package manticore
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
 	"github.com/spf13/viper"
 )
 
@@ -25,3 +33,309 @@ func TestNewManticore(t *testing.T) {
 		t.Errorf("Expected non-nil error, got nil")
 	}
 }
+
+// sqlServer 模擬 Manticore 的 /sql 端點，依查詢語句回傳對應的結果集
+func sqlServer(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		result, ok := results[string(body)]
+		if !ok {
+			t.Errorf("unexpected query: %s", body)
+			result = `[{"error":"unexpected query"}]`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(result))
+	}))
+}
+
+func TestInspector(t *testing.T) {
+	server := sqlServer(t, map[string]string{
+		"DESCRIBE idea": `[{"columns":[],"data":[
+			{"Field":"id","Type":"bigint","Properties":""},
+			{"Field":"name","Type":"text","Properties":"indexed stored"}
+		]}]`,
+		"SHOW TABLE idea STATUS": `[{"columns":[],"data":[
+			{"Variable_name":"table_type","Value":"rt"},
+			{"Variable_name":"indexed_documents","Value":42}
+		]}]`,
+		"SHOW STATUS LIKE 'cluster%'": `[{"columns":[],"data":[
+			{"Counter":"cluster_name","Value":"posts"},
+			{"Counter":"cluster_posts_status","Value":"primary"}
+		]}]`,
+	})
+	defer server.Close()
+	viper.Set("manticore.url", server.URL)
+	defer viper.Set("manticore.url", "")
+
+	inspector, err := NewInspector()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	ctx := context.Background()
+
+	fields, err := inspector.Describe(ctx, "idea")
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if len(fields) != 2 || fields[1] != (Field{Name: "name", Type: "text", Properties: "indexed stored"}) {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+
+	status, err := inspector.TableStatus(ctx, "idea")
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if status["indexed_documents"] != "42" {
+		t.Errorf("Expected 42 indexed documents, got %q", status["indexed_documents"])
+	}
+
+	replication, err := inspector.ReplicationStatus(ctx)
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if replication["cluster_posts_status"] != "primary" {
+		t.Errorf("Expected primary cluster status, got %q", replication["cluster_posts_status"])
+	}
+}
+
+func TestInspectorMissingTable(t *testing.T) {
+	server := sqlServer(t, map[string]string{
+		"DESCRIBE idea": `[{"error":"no such table 'idea'"}]`,
+	})
+	defer server.Close()
+	viper.Set("manticore.url", server.URL)
+	defer viper.Set("manticore.url", "")
+
+	inspector, err := NewInspector()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if _, err := inspector.Describe(context.Background(), "idea"); err == nil {
+		t.Errorf("Expected non-nil error, got nil")
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		temporary bool
+	}{
+		{http.StatusServiceUnavailable, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadRequest, false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte(`{"error":"failed"}`))
+		}))
+		viper.Set("manticore.url", server.URL)
+
+		client, err := NewManticore()
+		if err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+		err = client.Delete(context.Background(), "idea", 1)
+		if err == nil {
+			t.Errorf("status %d: expected non-nil error, got nil", tc.status)
+		}
+		if IsTemporary(err) != tc.temporary {
+			t.Errorf("status %d: expected temporary %v, got %v (%v)", tc.status, tc.temporary, IsTemporary(err), err)
+		}
+		server.Close()
+	}
+	viper.Set("manticore.url", "")
+
+	// 查詢錯誤與呼叫端取消不應重試
+	if IsTemporary(fmt.Errorf("sql query failed: %w", ErrQuery)) {
+		t.Errorf("Expected query error not to be temporary")
+	}
+	if IsTemporary(fmt.Errorf("search failed: %w", context.Canceled)) {
+		t.Errorf("Expected canceled context not to be temporary")
+	}
+}
+
+// fakeNode 模擬單一 Manticore 節點，記錄收到的請求與寫入的表名稱
+type fakeNode struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	tables   []string
+	// down 為 true 時以 503 回應所有請求
+	down bool
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	node := &fakeNode{}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		node.requests = append(node.requests, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if node.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/search":
+			_, _ = w.Write([]byte(`{"took":0,"timed_out":false,"hits":{"total":0,"hits":[]}}`))
+		case "/sql":
+			_, _ = w.Write([]byte(`[{"columns":[],"data":[],"total":0,"error":"","warning":""}]`))
+		default:
+			var body struct {
+				Table string `json:"table"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			node.tables = append(node.tables, body.Table)
+			_, _ = w.Write([]byte(`{"table":"idea","id":1,"created":true,"result":"created","status":201}`))
+		}
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (n *fakeNode) setDown(down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down = down
+}
+
+// count 回傳 path 收到的請求數
+func (n *fakeNode) count(path string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, request := range n.requests {
+		if request == path {
+			count++
+		}
+	}
+	return count
+}
+
+func setNodes(t *testing.T, cluster string, nodes ...NodeConfig) {
+	viper.Set("manticore.nodes", nodes)
+	viper.Set("manticore.cluster", cluster)
+	viper.Set("manticore.eject_after", 1)
+	viper.Set("manticore.eject_duration", "1m")
+	t.Cleanup(func() {
+		viper.Set("manticore.nodes", nil)
+		viper.Set("manticore.cluster", "")
+	})
+}
+
+func TestClusterRouting(t *testing.T) {
+	writer, reader1, reader2 := newFakeNode(t), newFakeNode(t), newFakeNode(t)
+	setNodes(t, "posts",
+		NodeConfig{URL: writer.URL, Role: RoleWrite},
+		NodeConfig{URL: reader1.URL, Role: RoleRead},
+		NodeConfig{URL: reader2.URL, Role: RoleRead},
+	)
+	client, err := NewManticore()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	ctx := context.Background()
+
+	// 寫入送往寫入節點，並加上叢集前綴
+	if _, err := client.Create(ctx, "idea", map[string]interface{}{"name": "forest"}); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if err := client.Replace(ctx, "idea", 1, map[string]interface{}{"name": "forest"}); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if len(writer.tables) != 2 || writer.tables[0] != "posts:idea" || writer.tables[1] != "posts:idea" {
+		t.Errorf("Expected writes to posts:idea on the write node, got %v", writer.tables)
+	}
+	if len(reader1.tables)+len(reader2.tables) != 0 {
+		t.Errorf("Expected no writes on read nodes")
+	}
+
+	// 搜尋輪流送往讀取節點
+	for i := 0; i < 4; i++ {
+		if _, err := client.Search(ctx, Manticoresearch.NewSearchRequest("idea")); err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+	}
+	if reader1.count("/search") != 2 || reader2.count("/search") != 2 || writer.count("/search") != 0 {
+		t.Errorf("Expected searches to be spread across read nodes, got %d/%d/%d",
+			reader1.count("/search"), reader2.count("/search"), writer.count("/search"))
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	writer, reader1, reader2 := newFakeNode(t), newFakeNode(t), newFakeNode(t)
+	setNodes(t, "",
+		NodeConfig{URL: writer.URL, Role: RoleWrite},
+		NodeConfig{URL: reader1.URL, Role: RoleRead},
+		NodeConfig{URL: reader2.URL, Role: RoleRead},
+	)
+	client, err := NewManticore()
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	ctx := context.Background()
+
+	// 故障的複本改送下一個，並在之後被移出
+	reader1.setDown(true)
+	for i := 0; i < 4; i++ {
+		if _, err := client.Search(ctx, Manticoresearch.NewSearchRequest("idea")); err != nil {
+			t.Fatalf("Expected nil error, got %v", err)
+		}
+	}
+	if reader1.count("/search") != 1 || reader2.count("/search") != 4 {
+		t.Errorf("Expected failed replica to be ejected, got %d/%d", reader1.count("/search"), reader2.count("/search"))
+	}
+
+	// 所有複本故障時由寫入節點負責搜尋
+	reader2.setDown(true)
+	if _, err := client.Search(ctx, Manticoresearch.NewSearchRequest("idea")); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if writer.count("/search") != 1 {
+		t.Errorf("Expected search to fall back to the write node, got %d", writer.count("/search"))
+	}
+
+	// 健康檢查讓恢復的複本重新加入
+	reader1.setDown(false)
+	reader2.setDown(false)
+	if ok, err := client.Health(ctx); !ok || err != nil {
+		t.Fatalf("Expected healthy cluster, got %v %v", ok, err)
+	}
+	if _, err := client.Search(ctx, Manticoresearch.NewSearchRequest("idea")); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if writer.count("/search") != 1 {
+		t.Errorf("Expected recovered replicas to serve searches")
+	}
+
+	// 沒有叢集時寫入節點故障就無法寫入
+	writer.setDown(true)
+	if err := client.Delete(ctx, "idea", 1); err == nil || !IsTemporary(err) {
+		t.Errorf("Expected temporary error, got %v", err)
+	}
+	if ok, _ := client.Health(ctx); ok {
+		t.Errorf("Expected unhealthy cluster without a write node")
+	}
+}
+
+func TestClusterConfig(t *testing.T) {
+	setNodes(t, "",
+		NodeConfig{URL: "http://a:9308", Role: RoleWrite},
+		NodeConfig{URL: "http://b:9308", Role: RoleWrite},
+	)
+	if _, err := NewManticore(); err == nil {
+		t.Errorf("Expected error for several write nodes without a cluster")
+	}
+
+	setNodes(t, "", NodeConfig{URL: "http://a:9308", Role: RoleRead})
+	if _, err := NewManticore(); err == nil {
+		t.Errorf("Expected error without a write node")
+	}
+
+	setNodes(t, "", NodeConfig{URL: "http://a:9308", Role: "primary"})
+	if _, err := NewManticore(); err == nil {
+		t.Errorf("Expected error for unknown role")
+	}
+}
@@ -0,0 +1,48 @@
+package manticore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sqlRows 執行 SQL 查詢 (raw 模式)，並回傳第一個結果集的資料列
+func (c *manticore) sqlRows(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	sqlRes, httpRes, err := c.apiClient.UtilsAPI.Sql(ctx).Body(query).RawResponse(true).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("sql query failed: %w", withStatus(httpRes, err))
+	}
+
+	if httpRes.StatusCode != 200 {
+		return nil, fmt.Errorf("sql query failed with %w", &StatusError{StatusCode: httpRes.StatusCode})
+	}
+
+	if sqlRes == nil || sqlRes.ArrayOfMapmapOfStringinterface == nil || len(*sqlRes.ArrayOfMapmapOfStringinterface) == 0 {
+		return nil, nil
+	}
+
+	resultSet := (*sqlRes.ArrayOfMapmapOfStringinterface)[0]
+	if errMsg, ok := resultSet["error"].(string); ok && errMsg != "" {
+		return nil, fmt.Errorf("sql query failed: %w: %s", ErrQuery, errMsg)
+	}
+
+	data, ok := resultSet["data"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(data))
+	for _, item := range data {
+		if row, ok := item.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// quote 將字串轉為 SQL 字串常值，跳脫反斜線與單引號
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
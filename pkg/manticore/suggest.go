@@ -0,0 +1,27 @@
+package manticore
+
+import (
+	"context"
+	"fmt"
+)
+
+// Suggest 使用 CALL SUGGEST 取得與 word 拼寫相近的詞，依距離排序
+func (c *manticore) Suggest(ctx context.Context, table string, word string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+
+	query := fmt.Sprintf("CALL SUGGEST(%s, %s, %d AS limit)", quote(word), quote(table), limit)
+	rows, err := c.sqlRows(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("suggest failed: %w", err)
+	}
+
+	suggestions := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if suggest, ok := row["suggest"].(string); ok && suggest != "" {
+			suggestions = append(suggestions, suggest)
+		}
+	}
+	return suggestions, nil
+}
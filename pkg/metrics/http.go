@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute 沒有對應路由的請求，避免以任意路徑作為標籤
+const unmatchedRoute = "unmatched"
+
+// GinHandler 記錄每個路由的請求次數與處理時間，skipPaths 中的路徑不記錄
+func GinHandler(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if skip[route] {
+			c.Next()
+			return
+		}
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		start := time.Now()
+		c.Next()
+
+		code := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(route, c.Request.Method, code).Inc()
+		httpDuration.WithLabelValues(route, c.Request.Method, code).Observe(time.Since(start).Seconds())
+	}
+}
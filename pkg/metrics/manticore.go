@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+)
+
+// instrumented 記錄每個 ManticoreService 方法的延遲與錯誤
+type instrumented struct {
+	next manticore.ManticoreService
+}
+
+// Manticore 包裝 ManticoreService，為每次呼叫記錄指標
+func Manticore(next manticore.ManticoreService) manticore.ManticoreService {
+	return &instrumented{next: next}
+}
+
+// observe 依呼叫結果記錄延遲，失敗時同時累計錯誤次數
+func observe(operation string, start time.Time, err error) {
+	status := statusOK
+	switch {
+	case errors.Is(err, manticore.ErrDocumentNotFound):
+		status = statusNotFound
+	case err != nil:
+		status = statusError
+	}
+	manticoreDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+	if err != nil {
+		manticoreErrors.WithLabelValues(operation, status).Inc()
+	}
+}
+
+func (m *instrumented) Create(ctx context.Context, index string, data map[string]interface{}) (id int64, err error) {
+	defer func(start time.Time) { observe("create", start, err) }(time.Now())
+	return m.next.Create(ctx, index, data)
+}
+
+func (m *instrumented) Read(ctx context.Context, index string, id int64) (source map[string]interface{}, err error) {
+	defer func(start time.Time) { observe("read", start, err) }(time.Now())
+	return m.next.Read(ctx, index, id)
+}
+
+func (m *instrumented) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe("replace", start, err) }(time.Now())
+	return m.next.Replace(ctx, index, id, data)
+}
+
+func (m *instrumented) Update(ctx context.Context, index string, id int64, data map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe("update", start, err) }(time.Now())
+	return m.next.Update(ctx, index, id, data)
+}
+
+func (m *instrumented) Delete(ctx context.Context, index string, id int64) (err error) {
+	defer func(start time.Time) { observe("delete", start, err) }(time.Now())
+	return m.next.Delete(ctx, index, id)
+}
+
+func (m *instrumented) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (response *Manticoresearch.SearchResponse, err error) {
+	defer func(start time.Time) { observe("search", start, err) }(time.Now())
+	return m.next.Search(ctx, searchRequest)
+}
+
+func (m *instrumented) Suggest(ctx context.Context, index string, word string, limit int) (suggestions []string, err error) {
+	defer func(start time.Time) { observe("suggest", start, err) }(time.Now())
+	return m.next.Suggest(ctx, index, word, limit)
+}
+
+// Health 除了記錄延遲，也更新 Manticore 健康狀態的 gauge
+func (m *instrumented) Health(ctx context.Context) (ok bool, err error) {
+	defer func(start time.Time) {
+		observe("health", start, err)
+		if ok && err == nil {
+			manticoreUp.Set(1)
+		} else {
+			manticoreUp.Set(0)
+		}
+	}(time.Now())
+	return m.next.Health(ctx)
+}
+
+// WatchHealth 每隔 interval 呼叫一次 Health 更新健康狀態，直到 ctx 結束
+func WatchHealth(ctx context.Context, client manticore.ManticoreService, interval time.Duration) {
+	if _, ok := client.(*instrumented); !ok {
+		client = Manticore(client)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		client.Health(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "post"
+
+// 狀態標籤的值
+const (
+	statusOK       = "ok"
+	statusNotFound = "not_found"
+	statusError    = "error"
+)
+
+var (
+	// manticoreDuration Manticore 呼叫的延遲，依操作與結果分類
+	manticoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "manticore",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of Manticore calls by operation and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	// manticoreErrors Manticore 呼叫失敗的次數，找不到文件也視為失敗
+	manticoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "manticore",
+		Name:      "errors_total",
+		Help:      "Failed Manticore calls by operation and status.",
+	}, []string{"operation", "status"})
+
+	// manticoreUp 最近一次健康檢查的結果，1 為正常
+	manticoreUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "manticore",
+		Name:      "up",
+		Help:      "Whether the last Manticore health check succeeded.",
+	})
+
+	// httpRequests HTTP 請求次數，route 為 gin 的路由樣板
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// httpDuration HTTP 請求的處理時間
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	registerOnce sync.Once
+)
+
+// Register 將所有指標註冊到 prometheus 的預設 registry，可重複呼叫
+func Register() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(
+			manticoreDuration,
+			manticoreErrors,
+			manticoreUp,
+			httpRequests,
+			httpDuration,
+		)
+	})
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/gin-gonic/gin"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubManticore 以固定的錯誤回應所有呼叫
+type stubManticore struct {
+	err     error
+	healthy bool
+}
+
+func (s *stubManticore) Create(ctx context.Context, index string, data map[string]interface{}) (int64, error) {
+	return 1, s.err
+}
+
+func (s *stubManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	return nil, s.err
+}
+
+func (s *stubManticore) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return s.err
+}
+
+func (s *stubManticore) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return s.err
+}
+
+func (s *stubManticore) Delete(ctx context.Context, index string, id int64) error {
+	return s.err
+}
+
+func (s *stubManticore) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
+	return nil, s.err
+}
+
+func (s *stubManticore) Suggest(ctx context.Context, index string, word string, limit int) ([]string, error) {
+	return nil, s.err
+}
+
+func (s *stubManticore) Health(ctx context.Context) (bool, error) {
+	return s.healthy, s.err
+}
+
+func TestManticoreMetrics(t *testing.T) {
+	stub := &stubManticore{healthy: true}
+	client := Manticore(stub)
+
+	before := testutil.ToFloat64(manticoreErrors.WithLabelValues("search", statusError))
+	_, err := client.Search(context.Background(), Manticoresearch.NewSearchRequest("idea"))
+	assert.NoError(t, err)
+	assert.Equal(t, before, testutil.ToFloat64(manticoreErrors.WithLabelValues("search", statusError)))
+
+	stub.err = errors.New("connection refused")
+	_, err = client.Search(context.Background(), Manticoresearch.NewSearchRequest("idea"))
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(manticoreErrors.WithLabelValues("search", statusError)))
+
+	stub.err = manticore.ErrDocumentNotFound
+	notFound := testutil.ToFloat64(manticoreErrors.WithLabelValues("read", statusNotFound))
+	_, err = client.Read(context.Background(), "idea", 1)
+	assert.ErrorIs(t, err, manticore.ErrDocumentNotFound)
+	assert.Equal(t, notFound+1, testutil.ToFloat64(manticoreErrors.WithLabelValues("read", statusNotFound)))
+
+	// 每個操作與結果都記錄延遲
+	assert.Equal(t, 3, testutil.CollectAndCount(manticoreDuration))
+
+	stub.err = nil
+	client.Health(context.Background())
+	assert.Equal(t, float64(1), testutil.ToFloat64(manticoreUp))
+	stub.healthy = false
+	client.Health(context.Background())
+	assert.Equal(t, float64(0), testutil.ToFloat64(manticoreUp))
+}
+
+func TestGinHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(GinHandler("/metrics"))
+	engine.GET("/idea/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	engine.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/idea/1", "/idea/2", "/metrics", "/unknown"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequests.WithLabelValues("/idea/:id", "GET", "204")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues(unmatchedRoute, "GET", "404")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpRequests.WithLabelValues("/metrics", "GET", "200")))
+}
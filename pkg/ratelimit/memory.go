@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval Memory 移除已補滿 bucket 的間隔
+const pruneInterval = time.Minute
+
+// bucket 一個 client 的 token bucket
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// refill 回傳 now 時的 token 數
+func (b *bucket) refill(now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	return math.Min(b.limit.capacity(), b.tokens+elapsed*b.limit.rate())
+}
+
+// Memory 行程內的 Store，只限制單一實例的請求
+type Memory struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+// NewMemory 創建行程內的 Store
+func NewMemory() *Memory {
+	return &Memory{now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Take 實現 Store，新的 client 從補滿的 bucket 開始
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.prune(now)
+	b, ok := m.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{limit: limit, tokens: limit.capacity()}
+		m.buckets[key] = b
+	} else {
+		b.tokens = b.refill(now)
+	}
+	b.updated = now
+
+	capacity, rate := limit.capacity(), limit.rate()
+	result := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+	return result, nil
+}
+
+// Len 回傳目前保存的 bucket 數
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+// prune 每隔 pruneInterval 移除已補滿的 bucket，與新的 bucket 相同，移除後不影響限制
+func (m *Memory) prune(now time.Time) {
+	if now.Sub(m.pruned) < pruneInterval {
+		return
+	}
+	m.pruned = now
+	for key, b := range m.buckets {
+		if b.refill(now) >= b.limit.capacity() {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// budget 的名稱，也是設定檔 ratelimit.budgets.<名稱> 的鍵
+const (
+	BudgetSearch       = "search"
+	BudgetWrite        = "write"
+	BudgetAutocomplete = "autocomplete"
+)
+
+// Limit 一個 budget 的 token bucket
+type Limit struct {
+	// Requests 每個 Period 補充的 token 數
+	Requests int `mapstructure:"requests"`
+	// Period 補充 Requests 個 token 所需的時間
+	Period time.Duration `mapstructure:"period"`
+	// Burst bucket 的容量，未設定時與 Requests 相同
+	Burst int `mapstructure:"burst"`
+}
+
+// capacity 回傳 bucket 的容量
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate 回傳每秒補充的 token 數
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) validate() error {
+	if l.Requests <= 0 {
+		return fmt.Errorf("requests must be greater than zero")
+	}
+	if l.Period <= 0 {
+		return fmt.Errorf("period must be greater than zero")
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+// Result 取出 token 的結果
+type Result struct {
+	// Allowed 是否取得 token
+	Allowed bool
+	// Limit bucket 的容量
+	Limit int
+	// Remaining 取出後剩餘的 token 數
+	Remaining int
+	// Reset bucket 補滿所需的時間
+	Reset time.Duration
+	// RetryAfter 未取得 token 時，下一個 token 補充所需的時間
+	RetryAfter time.Duration
+}
+
+// Store 保存每個 client 的 token bucket。
+// 預設為行程內的 Memory，多個實例需要共用額度時可改以 Redis 等外部儲存實作，Take 必須是原子操作。
+type Store interface {
+	// Take 依 limit 補充 key 的 bucket 後取出一個 token
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Limiter 依 budget 限制每個 client 的請求
+type Limiter struct {
+	store   Store
+	budgets map[string]Limit
+}
+
+// NewLimiter 以 store 保存 budgets 中每個 budget 的 token bucket，未列出的 budget 不限制
+func NewLimiter(store Store, budgets map[string]Limit) (*Limiter, error) {
+	for name, limit := range budgets {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("invalid ratelimit.budgets.%s: %w", name, err)
+		}
+	}
+	return &Limiter{store: store, budgets: budgets}, nil
+}
+
+// LoadBudgets 讀取 ratelimit.budgets
+func LoadBudgets() (map[string]Limit, error) {
+	var budgets map[string]Limit
+	if err := viper.UnmarshalKey("ratelimit.budgets", &budgets); err != nil {
+		return nil, fmt.Errorf("invalid ratelimit.budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// LoadTrustedProxies 讀取 ratelimit.trusted_proxies，項目可為 IP 或 CIDR
+func LoadTrustedProxies() ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, value := range viper.GetStringSlice("ratelimit.trusted_proxies") {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ratelimit.trusted_proxies: %s", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ratelimit.trusted_proxies: %w", err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// Take 從 client 在 budget 的 bucket 取出一個 token，budget 不限制時 limited 為 false
+func (l *Limiter) Take(ctx context.Context, budget string, client string) (result Result, limited bool, err error) {
+	limit, ok := l.budgets[budget]
+	if !ok {
+		return Result{}, false, nil
+	}
+	result, err = l.store.Take(ctx, budget+":"+client, limit)
+	return result, true, err
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemory()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+	// 新的 client 從補滿的 bucket 開始，可以連續取出 Burst 個 token
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(ctx, "a", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+	result, _ := store.Take(ctx, "a", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// 其他 client 的 bucket 互不影響
+	result, _ = store.Take(ctx, "b", limit)
+	assert.True(t, result.Allowed)
+
+	// 每秒補充 Requests 個 token
+	now = now.Add(500 * time.Millisecond)
+	result, _ = store.Take(ctx, "a", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// 補滿的 bucket 在 pruneInterval 後移除
+	assert.Equal(t, 2, store.Len())
+	now = now.Add(pruneInterval)
+	result, _ = store.Take(ctx, "c", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	limiter, err := NewLimiter(store, map[string]Limit{
+		BudgetSearch: {Requests: 1, Period: time.Minute},
+	})
+	assert.NoError(t, err)
+
+	result, limited, err := limiter.Take(ctx, BudgetSearch, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, limited)
+	assert.True(t, result.Allowed)
+	result, _, _ = limiter.Take(ctx, BudgetSearch, "ip:10.0.0.1")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// 每個 budget 各自計算，未設定的 budget 不限制
+	_, limited, err = limiter.Take(ctx, BudgetWrite, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+
+	_, err = NewLimiter(NewMemory(), map[string]Limit{BudgetWrite: {Requests: 1}})
+	assert.Error(t, err)
+	_, err = NewLimiter(NewMemory(), map[string]Limit{BudgetWrite: {Period: time.Second}})
+	assert.Error(t, err)
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	defer viper.Set("ratelimit.trusted_proxies", nil)
+
+	viper.Set("ratelimit.trusted_proxies", []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"})
+	proxies, err := LoadTrustedProxies()
+	assert.NoError(t, err)
+	assert.Len(t, proxies, 3)
+	assert.True(t, proxies[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, proxies[1].Contains(net.ParseIP("192.0.2.1")))
+	assert.False(t, proxies[1].Contains(net.ParseIP("192.0.2.2")))
+	assert.True(t, proxies[2].Contains(net.ParseIP("2001:db8::1")))
+
+	viper.Set("ratelimit.trusted_proxies", []string{"proxy.local"})
+	_, err = LoadTrustedProxies()
+	assert.Error(t, err)
+}
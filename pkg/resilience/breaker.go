@@ -0,0 +1,88 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 斷路器開啟中，請求未送出即失敗
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type state int
+
+const (
+	closed state = iota
+	open
+	halfOpen
+)
+
+// breaker 連續失敗達 threshold 次後開啟，經過 openTimeout 後進入半開狀態，
+// 只放行一個試探請求：成功則關閉，失敗則重新開啟
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    state
+	failures int
+	openedAt time.Time
+	// probing 半開狀態下是否已有試探請求
+	probing bool
+}
+
+func newBreaker(policy Policy, now func() time.Time) *breaker {
+	return &breaker{
+		threshold:   policy.FailureThreshold,
+		openTimeout: policy.OpenTimeout,
+		now:         now,
+	}
+}
+
+// allow 判斷是否可以送出請求
+func (b *breaker) allow() error {
+	if b.threshold == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case open:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = halfOpen
+		b.probing = true
+		return nil
+	case halfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record 記錄請求結果，failure 只計入暫時性的錯誤
+func (b *breaker) record(failure bool) {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failure {
+		b.state = closed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.state == halfOpen || b.failures >= b.threshold {
+		b.state = open
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
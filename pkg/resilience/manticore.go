@@ -0,0 +1,146 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+)
+
+// client 為每個操作套用重試與斷路器，斷路器的狀態由所有請求共用
+type client struct {
+	next     manticore.ManticoreService
+	policies map[string]Policy
+	breakers map[string]*breaker
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// Manticore 包裝 ManticoreService，依 policies 重試暫時性錯誤，並在後端持續失敗時以 ErrCircuitOpen 快速失敗。
+// 回傳的實例應在整個服務中共用，斷路器才能反映後端的狀態。policies 可以為 nil，未設定的操作使用預設值，
+// 預設值寫入 client 自己的副本，不修改 policies。
+func Manticore(next manticore.ManticoreService, policies map[string]Policy) manticore.ManticoreService {
+	c := &client{
+		next:     next,
+		policies: make(map[string]Policy, len(Operations)),
+		breakers: make(map[string]*breaker, len(Operations)),
+		sleep:    sleep,
+	}
+	for _, operation := range Operations {
+		policy, ok := policies[operation]
+		if !ok {
+			policy = defaultPolicy
+			if !idempotent[operation] {
+				policy.MaxAttempts = 1
+			}
+		}
+		c.policies[operation] = policy
+		c.breakers[operation] = newBreaker(policy, time.Now)
+	}
+	return c
+}
+
+// sleep 等待 d，ctx 結束時提早返回
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff 回傳第 attempt 次失敗後的等待時間，以指數增加並隨機取其一半到全部，避免同時重試
+func backoff(policy Policy, attempt int) time.Duration {
+	d := policy.InitialBackoff << (attempt - 1)
+	if d > policy.MaxBackoff || d <= 0 {
+		d = policy.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int64N(int64(d-half)+1))
+}
+
+// call 以操作的設定執行 fn
+func (c *client) call(ctx context.Context, operation string, fn func() error) error {
+	policy := c.policies[operation]
+	breaker := c.breakers[operation]
+	for attempt := 1; ; attempt++ {
+		if err := breaker.allow(); err != nil {
+			return fmt.Errorf("manticore %s: %w", operation, err)
+		}
+		err := fn()
+		temporary := manticore.IsTemporary(err)
+		breaker.record(temporary)
+		if !temporary || attempt >= policy.MaxAttempts {
+			return err
+		}
+		if sleepErr := c.sleep(ctx, backoff(policy, attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (c *client) Create(ctx context.Context, index string, data map[string]interface{}) (id int64, err error) {
+	err = c.call(ctx, "create", func() error {
+		id, err = c.next.Create(ctx, index, data)
+		return err
+	})
+	return id, err
+}
+
+func (c *client) Read(ctx context.Context, index string, id int64) (source map[string]interface{}, err error) {
+	err = c.call(ctx, "read", func() error {
+		source, err = c.next.Read(ctx, index, id)
+		return err
+	})
+	return source, err
+}
+
+func (c *client) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return c.call(ctx, "replace", func() error {
+		return c.next.Replace(ctx, index, id, data)
+	})
+}
+
+func (c *client) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return c.call(ctx, "update", func() error {
+		return c.next.Update(ctx, index, id, data)
+	})
+}
+
+func (c *client) Delete(ctx context.Context, index string, id int64) error {
+	return c.call(ctx, "delete", func() error {
+		return c.next.Delete(ctx, index, id)
+	})
+}
+
+func (c *client) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (response *Manticoresearch.SearchResponse, err error) {
+	err = c.call(ctx, "search", func() error {
+		response, err = c.next.Search(ctx, searchRequest)
+		return err
+	})
+	return response, err
+}
+
+func (c *client) Suggest(ctx context.Context, index string, word string, limit int) (suggestions []string, err error) {
+	err = c.call(ctx, "suggest", func() error {
+		suggestions, err = c.next.Suggest(ctx, index, word, limit)
+		return err
+	})
+	return suggestions, err
+}
+
+func (c *client) Health(ctx context.Context) (ok bool, err error) {
+	err = c.call(ctx, "health", func() error {
+		ok, err = c.next.Health(ctx)
+		return err
+	})
+	return ok, err
+}
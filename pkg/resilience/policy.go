@@ -0,0 +1,82 @@
+package resilience
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Policy 單一操作的重試與斷路器設定
+type Policy struct {
+	// MaxAttempts 最多嘗試次數 (含第一次)，非冪等的操作固定為 1
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialBackoff 第一次重試前的等待時間，之後每次加倍，最多為 MaxBackoff
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// FailureThreshold 連續失敗幾次後斷路，為 0 時不使用斷路器
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// OpenTimeout 斷路後經過多久允許一次試探請求
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+}
+
+// Operations 為 ManticoreService 的操作名稱，也是設定檔 resilience.operations 的鍵
+var Operations = []string{"create", "read", "replace", "update", "delete", "search", "suggest", "health"}
+
+// idempotent 可以安全重試的操作；Create 重試可能建立重複文件，Health 重試會掩蓋問題
+var idempotent = map[string]bool{
+	"read":    true,
+	"replace": true,
+	"update":  true,
+	"delete":  true,
+	"search":  true,
+	"suggest": true,
+}
+
+// defaultPolicy 未設定 resilience.default 時的設定
+var defaultPolicy = Policy{
+	MaxAttempts:      3,
+	InitialBackoff:   50 * time.Millisecond,
+	MaxBackoff:       time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      10 * time.Second,
+}
+
+func (p Policy) validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("max_attempts must be at least 1")
+	case p.InitialBackoff < 0 || p.MaxBackoff < p.InitialBackoff:
+		return fmt.Errorf("backoff must satisfy 0 <= initial_backoff <= max_backoff")
+	case p.FailureThreshold < 0:
+		return fmt.Errorf("failure_threshold must not be negative")
+	case p.FailureThreshold > 0 && p.OpenTimeout <= 0:
+		return fmt.Errorf("open_timeout must be greater than zero")
+	}
+	return nil
+}
+
+// LoadPolicies 讀取 resilience.default 與 resilience.operations.<操作>，
+// 未設定的欄位依序沿用 resilience.default 與內建的預設值
+func LoadPolicies() (map[string]Policy, error) {
+	base := defaultPolicy
+	if err := viper.UnmarshalKey("resilience.default", &base); err != nil {
+		return nil, fmt.Errorf("invalid resilience.default: %w", err)
+	}
+
+	policies := make(map[string]Policy, len(Operations))
+	for _, operation := range Operations {
+		policy := base
+		if err := viper.UnmarshalKey("resilience.operations."+operation, &policy); err != nil {
+			return nil, fmt.Errorf("invalid resilience.operations.%s: %w", operation, err)
+		}
+		if !idempotent[operation] {
+			policy.MaxAttempts = 1
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid resilience policy for %s: %w", operation, err)
+		}
+		policies[operation] = policy
+	}
+	return policies, nil
+}
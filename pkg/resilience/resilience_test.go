@@ -0,0 +1,212 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arwoosa/post/pkg/manticore"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// errUnavailable 模擬 Manticore 回傳 503
+var errUnavailable = &manticore.StatusError{StatusCode: 503}
+
+// stubManticore 依序回傳 errs 中的錯誤，用完後回傳 nil，並記錄每個操作的呼叫次數
+type stubManticore struct {
+	errs  []error
+	calls map[string]int
+}
+
+func newStub(errs ...error) *stubManticore {
+	return &stubManticore{errs: errs, calls: map[string]int{}}
+}
+
+func (s *stubManticore) next(operation string) error {
+	s.calls[operation]++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *stubManticore) Create(ctx context.Context, index string, data map[string]interface{}) (int64, error) {
+	return 1, s.next("create")
+}
+
+func (s *stubManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	return map[string]interface{}{}, s.next("read")
+}
+
+func (s *stubManticore) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return s.next("replace")
+}
+
+func (s *stubManticore) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	return s.next("update")
+}
+
+func (s *stubManticore) Delete(ctx context.Context, index string, id int64) error {
+	return s.next("delete")
+}
+
+func (s *stubManticore) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
+	return &Manticoresearch.SearchResponse{}, s.next("search")
+}
+
+func (s *stubManticore) Suggest(ctx context.Context, index string, word string, limit int) ([]string, error) {
+	return nil, s.next("suggest")
+}
+
+func (s *stubManticore) Health(ctx context.Context) (bool, error) {
+	return true, s.next("health")
+}
+
+// newTestClient 創建不等待重試的 client
+func newTestClient(stub *stubManticore, policy Policy) *client {
+	policies := map[string]Policy{}
+	for _, operation := range Operations {
+		p := policy
+		if !idempotent[operation] {
+			p.MaxAttempts = 1
+		}
+		policies[operation] = p
+	}
+	c := Manticore(stub, policies).(*client)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		return ctx.Err()
+	}
+	return c
+}
+
+func TestRetry(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, FailureThreshold: 10, OpenTimeout: time.Second}
+
+	// 暫時性錯誤重試到成功
+	stub := newStub(errUnavailable, errUnavailable)
+	c := newTestClient(stub, policy)
+	_, err := c.Search(context.Background(), Manticoresearch.NewSearchRequest("idea"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stub.calls["search"])
+
+	// 超過嘗試次數時回傳最後的錯誤
+	stub = newStub(errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+	c = newTestClient(stub, policy)
+	err = c.Replace(context.Background(), "idea", 1, nil)
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 3, stub.calls["replace"])
+
+	// 找不到文件不重試
+	stub = newStub(fmt.Errorf("delete failed: %w", manticore.ErrDocumentNotFound))
+	c = newTestClient(stub, policy)
+	err = c.Delete(context.Background(), "idea", 1)
+	assert.ErrorIs(t, err, manticore.ErrDocumentNotFound)
+	assert.Equal(t, 1, stub.calls["delete"])
+
+	// Create 不冪等，不重試
+	stub = newStub(errUnavailable)
+	c = newTestClient(stub, policy)
+	_, err = c.Create(context.Background(), "idea", nil)
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 1, stub.calls["create"])
+
+	// 呼叫端取消時停止重試
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stub = newStub(errUnavailable, errUnavailable)
+	c = newTestClient(stub, policy)
+	_, err = c.Search(ctx, Manticoresearch.NewSearchRequest("idea"))
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 1, stub.calls["search"])
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	stub := newStub(errUnavailable, errUnavailable)
+	c := newTestClient(stub, Policy{MaxAttempts: 1, FailureThreshold: 2, OpenTimeout: 10 * time.Second})
+	c.breakers["delete"].now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, c.Delete(context.Background(), "idea", 1), errUnavailable)
+	}
+	// 連續失敗達門檻後直接失敗，不呼叫 Manticore
+	assert.ErrorIs(t, c.Delete(context.Background(), "idea", 1), ErrCircuitOpen)
+	assert.Equal(t, 2, stub.calls["delete"])
+	// 斷路器依操作分開
+	assert.NoError(t, c.Replace(context.Background(), "idea", 1, nil))
+
+	// 逾時後的試探請求失敗，重新斷路
+	now = now.Add(10 * time.Second)
+	stub.errs = []error{errUnavailable}
+	assert.ErrorIs(t, c.Delete(context.Background(), "idea", 1), errUnavailable)
+	assert.ErrorIs(t, c.Delete(context.Background(), "idea", 1), ErrCircuitOpen)
+
+	// 試探請求成功後恢復
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, c.Delete(context.Background(), "idea", 1))
+	assert.NoError(t, c.Delete(context.Background(), "idea", 1))
+	assert.Equal(t, 5, stub.calls["delete"])
+}
+
+func TestBreakerIgnoresPermanentErrors(t *testing.T) {
+	errs := make([]error, 5)
+	for i := range errs {
+		errs[i] = fmt.Errorf("sql query failed: %w", manticore.ErrQuery)
+	}
+	stub := newStub(errs...)
+	c := newTestClient(stub, Policy{MaxAttempts: 3, FailureThreshold: 2, OpenTimeout: time.Second})
+
+	for range errs {
+		_, err := c.Suggest(context.Background(), "idea", "forest", 5)
+		assert.True(t, errors.Is(err, manticore.ErrQuery))
+	}
+	assert.Equal(t, 5, stub.calls["suggest"])
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		d := backoff(policy, attempt)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	viper.Set("resilience.default.max_attempts", 4)
+	viper.Set("resilience.default.open_timeout", "30s")
+	viper.Set("resilience.operations.search.max_attempts", 2)
+	defer viper.Set("resilience", nil)
+
+	policies, err := LoadPolicies()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, policies["search"].MaxAttempts)
+	assert.Equal(t, 4, policies["delete"].MaxAttempts)
+	assert.Equal(t, 30*time.Second, policies["search"].OpenTimeout)
+	assert.Equal(t, defaultPolicy.InitialBackoff, policies["delete"].InitialBackoff)
+	assert.Equal(t, 1, policies["create"].MaxAttempts)
+
+	viper.Set("resilience.operations.search.max_attempts", 0)
+	_, err = LoadPolicies()
+	assert.Error(t, err)
+}
+
+func TestManticoreDefaultPolicies(t *testing.T) {
+	// policies 為 nil 時所有操作使用預設值
+	c := Manticore(newStub(), nil).(*client)
+	assert.Equal(t, defaultPolicy.MaxAttempts, c.policies["search"].MaxAttempts)
+	assert.Equal(t, 1, c.policies["create"].MaxAttempts)
+
+	// 預設值不寫回呼叫端的 policies
+	policies := map[string]Policy{"search": {MaxAttempts: 2, FailureThreshold: 1, OpenTimeout: time.Second}}
+	c = Manticore(newStub(), policies).(*client)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, 2, c.policies["search"].MaxAttempts)
+	assert.Equal(t, defaultPolicy.MaxAttempts, c.policies["delete"].MaxAttempts)
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// 支援的 exporter
+const (
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Shutdown 送出尚未輸出的 span 並釋放 exporter 的資源
+type Shutdown func(ctx context.Context) error
+
+// Setup 設定 W3C trace context 的傳遞格式，並在 tracing.enabled 為 true 時，
+// 依 tracing.exporter 建立全域的 TracerProvider。
+// 未啟用時使用 otel 預設的 no-op TracerProvider，回傳的 Shutdown 不做任何事。
+func Setup(service string) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if !viper.GetBool("tracing.enabled") {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	writer, closeWriter, err := newWriter()
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+	if err != nil {
+		closeWriter()
+		return nil, fmt.Errorf("create trace exporter failed: %w", err)
+	}
+
+	ratio := 1.0
+	if viper.IsSet("tracing.sample_ratio") {
+		ratio = viper.GetFloat64("tracing.sample_ratio")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		defer closeWriter()
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// newWriter 依 tracing.exporter 回傳輸出 span 的位置
+func newWriter() (io.Writer, func() error, error) {
+	switch exporter := viper.GetString("tracing.exporter"); exporter {
+	case "", ExporterStdout:
+		return os.Stdout, func() error { return nil }, nil
+	case ExporterFile:
+		path := viper.GetString("tracing.file")
+		if path == "" {
+			return nil, nil, fmt.Errorf("tracing.file is empty")
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open trace file failed: %w", err)
+		}
+		return file, file.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing.exporter: %s", exporter)
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	shutdown, err := Setup("post")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	// 未啟用時仍會傳遞上游的 trace context
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	out := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out))
+	assert.Equal(t, header.Get("traceparent"), out.Get("traceparent"))
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	path := filepath.Join(t.TempDir(), "trace.json")
+	viper.Set("tracing.enabled", true)
+	viper.Set("tracing.exporter", ExporterFile)
+	viper.Set("tracing.file", path)
+
+	shutdown, err := Setup("post")
+	assert.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "IdeaService.SearchIdeas")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"IdeaService.SearchIdeas"`)
+	assert.Contains(t, string(content), `"Value":"post"`)
+}
+
+func TestSetupInvalidExporter(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("tracing.enabled", true)
+
+	viper.Set("tracing.exporter", "jaeger")
+	_, err := Setup("post")
+	assert.Error(t, err)
+
+	viper.Set("tracing.exporter", ExporterFile)
+	_, err = Setup("post")
+	assert.Error(t, err)
+}
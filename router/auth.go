@@ -0,0 +1,153 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/pkg/auth"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// claimsKey 驗證通過的 *auth.Claims 在 gin context 中的鍵
+	claimsKey = "auth.claims"
+	// rolesHeader 由 API gateway 驗證後帶入的角色，以逗號分隔，只在未啟用 JWT 驗證時採用
+	rolesHeader = "X-User-Roles"
+)
+
+// securedAPI 取代 err.CommonErrorHandler 嵌入 API，
+// 在 GetHandlers 中以 authenticated 包裝需要驗證的路由，未包裝的路由為公開，
+// 公開路由需要識別使用者時以 identified 包裝
+type securedAPI struct {
+	err.CommonErrorHandler
+	// verifier 為 nil 時不驗證，由 API gateway 負責
+	verifier *auth.Verifier
+	// policy 為 nil 時不檢查權限
+	policy *authz.Policy
+}
+
+// authenticated 回傳先驗證 Bearer token 再執行 handler 的 handler，
+// 驗證通過的 claims 以 claimsKey 存入 gin context，失敗時回傳 401
+func (a *securedAPI) authenticated(handler gin.HandlerFunc) gin.HandlerFunc {
+	if a.verifier == nil {
+		return handler
+	}
+	return func(c *gin.Context) {
+		claims, err := a.verify(c)
+		if err != nil {
+			challenge := "Bearer"
+			if !errors.Is(err, auth.ErrMissingToken) {
+				challenge = `Bearer error="invalid_token"`
+			}
+			c.Header("WWW-Authenticate", challenge)
+			a.GinErrorWithStatusHandler(c, http.StatusUnauthorized, err)
+			c.Abort()
+			return
+		}
+		c.Set(claimsKey, claims)
+		handler(c)
+	}
+}
+
+// identified 回傳帶有有效 Bearer token 時先將 claims 存入 gin context 再執行 handler 的 handler，
+// 供公開路由識別使用者；沒有 token 或 token 無效時以匿名身分執行，不回傳 401
+func (a *securedAPI) identified(handler gin.HandlerFunc) gin.HandlerFunc {
+	if a.verifier == nil {
+		return handler
+	}
+	return func(c *gin.Context) {
+		if claims, err := a.verify(c); err == nil {
+			c.Set(claimsKey, claims)
+		}
+		handler(c)
+	}
+}
+
+// verify 驗證 Authorization 標頭中的 Bearer token
+func (a *securedAPI) verify(c *gin.Context) (*auth.Claims, error) {
+	token, err := auth.BearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	return a.verifier.Verify(token)
+}
+
+// claimsFrom 取得 authenticated 或 identified 存入的 claims，匿名請求或未啟用驗證時回傳 false
+func claimsFrom(c *gin.Context) (*auth.Claims, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*auth.Claims)
+	return claims, ok
+}
+
+// userID 回傳驗證過的使用者 ID：啟用驗證時只採用 token 的 sub，未啟用時使用 API gateway 帶入的 userIDHeader
+func (a *securedAPI) userID(c *gin.Context) string {
+	if a.verifier == nil {
+		return c.GetHeader(userIDHeader)
+	}
+	if claims, ok := claimsFrom(c); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// principal 回傳目前的使用者與角色：啟用驗證時角色只從 token 讀取，未啟用時使用 API gateway 帶入的 rolesHeader
+func (a *securedAPI) principal(c *gin.Context) authz.Principal {
+	principal := authz.Principal{ID: a.userID(c)}
+	if a.verifier != nil {
+		if claims, ok := claimsFrom(c); ok {
+			principal.Roles = a.currentPolicy().RolesFromClaims(claims.Raw)
+		}
+		return principal
+	}
+	for _, role := range strings.Split(c.GetHeader(rolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			principal.Roles = append(principal.Roles, role)
+		}
+	}
+	return principal
+}
+
+// authorize 檢查目前的使用者是否可以對 ownerID 擁有的 idea 執行 action，
+// 拒絕時回傳 403 與原因並回傳 false；未設定 policy 時一律允許
+func (a *securedAPI) authorize(c *gin.Context, action string, ownerID string) bool {
+	if a.policy == nil {
+		return true
+	}
+	if err := a.policy.Authorize(a.principal(c), action, ownerID); err != nil {
+		a.GinErrorHandler(c, serviceError(err))
+		return false
+	}
+	return true
+}
+
+// defaultAdminPolicy 未設定 policy 時檢查管理操作的 Policy
+var defaultAdminPolicy = authz.AdminPolicy()
+
+// currentPolicy 回傳設定的 policy，未設定時回傳只允許管理操作的 defaultAdminPolicy
+func (a *securedAPI) currentPolicy() *authz.Policy {
+	if a.policy != nil {
+		return a.policy
+	}
+	return defaultAdminPolicy
+}
+
+// authorizeAdmin 檢查目前的使用者是否可以執行不針對個別 idea 的管理操作，
+// 沒有使用者時回傳 401，權限不足時回傳 403，並回傳 false；未設定 policy 時以 authz.AdminPolicy 檢查
+func (a *securedAPI) authorizeAdmin(c *gin.Context, action string) bool {
+	principal := a.principal(c)
+	if principal.ID == "" {
+		a.GinErrorWithStatusHandler(c, http.StatusUnauthorized, errors.New("authentication required"))
+		return false
+	}
+	if err := a.currentPolicy().Authorize(principal, action, ""); err != nil {
+		a.GinErrorHandler(c, serviceError(err))
+		return false
+	}
+	return true
+}
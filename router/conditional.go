@@ -0,0 +1,57 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etagMatches 判斷 If-Match 或 If-None-Match 標頭是否包含 etag。
+// weak 為 true 時忽略 W/ 前綴 (If-None-Match)，否則弱驗證的 ETag 一律不相符 (If-Match)。
+func etagMatches(header string, etag string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			if candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setValidators 設定回應的 ETag 與 Last-Modified
+func setValidators(c *gin.Context, etag string, modified time.Time) {
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified 依 If-None-Match 與 If-Modified-Since 判斷客戶端保存的內容是否仍有效，
+// 兩者同時帶入時只看 If-None-Match
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, etag, true)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	// HTTP 日期只精確到秒
+	return !modified.Truncate(time.Second).After(since)
+}
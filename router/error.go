@@ -0,0 +1,44 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	apiErr "github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/arwoosa/post/pkg/resilience"
+	"github.com/arwoosa/post/service"
+)
+
+// serviceErrorStatus 定義 service 層錯誤對應的 HTTP 狀態碼
+var serviceErrorStatus = []struct {
+	err    error
+	status int
+}{
+	{service.ErrInvalidCursor, http.StatusBadRequest},
+	{service.ErrCursorExpired, http.StatusBadRequest},
+	{service.ErrInvalidLimit, http.StatusBadRequest},
+	{service.ErrInvalidPage, http.StatusBadRequest},
+	{service.ErrPageOutOfRange, http.StatusBadRequest},
+	{service.ErrInvalidFields, http.StatusBadRequest},
+	{service.ErrInvalidRank, http.StatusBadRequest},
+	{service.ErrInvalidEvent, http.StatusBadRequest},
+	{service.ErrInvalidStatus, http.StatusBadRequest},
+	{service.ErrIdeaNotFound, http.StatusNotFound},
+	{service.ErrVersionConflict, http.StatusConflict},
+	{service.ErrIdeaInTrash, http.StatusConflict},
+	{service.ErrInvalidTransition, http.StatusConflict},
+	{authz.ErrForbidden, http.StatusForbidden},
+	{resilience.ErrCircuitOpen, http.StatusServiceUnavailable},
+}
+
+// serviceError 將 service 層的錯誤包裝為帶有對應狀態碼的 ApiError，
+// 未定義的錯誤原樣回傳，由錯誤處理器視為 500
+func serviceError(err error) error {
+	for _, mapping := range serviceErrorStatus {
+		if errors.Is(err, mapping.err) {
+			return apiErr.PkgError(mapping.status, err)
+		}
+	}
+	return err
+}
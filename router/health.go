@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/94peter/microservice/apitool"
+	"github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/arwoosa/post/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+type health struct {
+	err.CommonErrorHandler
+	// client 共用的 Manticore client，為 nil 時每個請求各自創建
+	client manticore.ManticoreService
+}
+
+func newHealth(client manticore.ManticoreService) apitool.GinAPI {
+	return &health{client: client}
+}
+
+func (m *health) GetHandlers() []*apitool.GinHandler {
+	return []*apitool.GinHandler{
+		{
+			Path:    livenessPath,
+			Method:  "GET",
+			Handler: m.liveness,
+		},
+		{
+			Path:    readinessPath,
+			Method:  "GET",
+			Handler: m.readiness,
+		},
+	}
+}
+
+// newHealthService 以共用或新創建的 Manticore client 創建 HealthService
+func (m *health) newHealthService() (*service.HealthService, error) {
+	client, err := manticoreClient(m.client)
+	if err != nil {
+		return nil, err
+	}
+	inspector, err := manticore.NewInspector()
+	if err != nil {
+		return nil, err
+	}
+	return service.NewHealthService(client, inspector), nil
+}
+
+// liveness 只要程序能處理請求就回傳 200，不檢查外部相依
+func (m *health) liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": service.CheckOK,
+	})
+}
+
+// readiness 所有檢查都通過時回傳 200，否則回傳 503，兩者都附上完整的檢查報告
+func (m *health) readiness(c *gin.Context) {
+	svc, err := m.newHealthService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	report := svc.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
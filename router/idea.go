@@ -1,26 +1,39 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/94peter/microservice/apitool"
-	"github.com/94peter/microservice/apitool/err"
 	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/authz"
 	"github.com/arwoosa/post/pkg/manticore"
 	"github.com/arwoosa/post/router/request"
 	"github.com/arwoosa/post/service"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// userIDHeader 由 API gateway 驗證後帶入的使用者 ID，只在未啟用 JWT 驗證時採用
+	userIDHeader = "X-User-Id"
+	// versionHeader idea 目前的版本，版本衝突時客戶端可依此重新讀取
+	versionHeader = "X-Idea-Version"
+)
+
 type idea struct {
-	err.CommonErrorHandler
+	securedAPI
+	// client 共用的 Manticore client，為 nil 時每個請求各自創建
+	client manticore.ManticoreService
+	// serviceOpts 創建 IdeaService 時套用的共用選項
+	serviceOpts []service.IdeaServiceOption
 }
 
-func newIdea() apitool.GinAPI {
-	return &idea{}
+func newIdea(client manticore.ManticoreService, secured securedAPI, serviceOpts ...service.IdeaServiceOption) apitool.GinAPI {
+	return &idea{securedAPI: secured, client: client, serviceOpts: serviceOpts}
 }
 
 func (m *idea) GetHandlers() []*apitool.GinHandler {
@@ -28,53 +41,264 @@ func (m *idea) GetHandlers() []*apitool.GinHandler {
 		{
 			Path:    "/idea",
 			Method:  "GET",
-			Handler: m.getIdeas,
+			Handler: m.identified(m.getIdeas),
 		},
 		{
 			Path:    "/idea",
 			Method:  "POST",
-			Handler: m.createIdea,
+			Handler: m.authenticated(m.createIdea),
+		},
+		{
+			Path:    "/idea/trash",
+			Method:  "GET",
+			Handler: m.authenticated(m.getTrash),
+		},
+		{
+			Path:    "/idea/:id",
+			Method:  "GET",
+			Handler: m.getIdea,
 		},
 		{
 			Path:    "/idea/:id",
 			Method:  "PUT",
-			Handler: m.updateIdea,
+			Handler: m.authenticated(m.updateIdea),
 		},
 		{
 			Path:    "/idea/:id",
 			Method:  "DELETE",
-			Handler: m.deleteIdea,
+			Handler: m.authenticated(m.deleteIdea),
+		},
+		{
+			Path:    "/idea/:id/restore",
+			Method:  "POST",
+			Handler: m.authenticated(m.restoreIdea),
+		},
+		{
+			Path:    "/idea/:id/status",
+			Method:  "POST",
+			Handler: m.authenticated(m.transitionIdea),
+		},
+		{
+			Path:    "/idea/:id/similar",
+			Method:  "GET",
+			Handler: m.getSimilarIdeas,
+		},
+		{
+			Path:    "/admin/idea",
+			Method:  "GET",
+			Handler: m.authenticated(m.adminSearchIdeas),
 		},
 	}
 }
 
+// newIdeaService 以共用或新創建的 Manticore client 創建 IdeaService
+func (m *idea) newIdeaService() (*service.IdeaService, error) {
+	client, err := manticoreClient(m.client)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewIdeaService(client, m.serviceOpts...), nil
+}
+
+// getIdeas 公開搜尋，只回傳已發布的 idea
 func (m *idea) getIdeas(c *gin.Context) {
-	// TODO: Parse query params
-	query := c.Query("query")
-	scroll := c.Query("scroll")
-	limit := int32(8) // 預設每頁 8 筆
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.ParseInt(limitStr, 10, 32); err == nil {
-			limit = int32(l)
+	params, err := m.searchParams(c)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	m.search(c, params)
+}
+
+// adminSearchIdeas 管理者搜尋，以 status 參數指定任意狀態，未指定時搜尋所有狀態；
+// 需要 policy 允許 search_all 的角色，未設定 policy 時為 moderator 或 admin
+func (m *idea) adminSearchIdeas(c *gin.Context) {
+	if !m.authorizeAdmin(c, authz.ActionSearchAll) {
+		return
+	}
+	params, err := m.searchParams(c)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	params.Statuses = queryList(c, "status")
+	if len(params.Statuses) == 0 {
+		params.Statuses = model.Statuses
+	}
+	m.search(c, params)
+}
+
+// searchParams 解析搜尋的 query 參數
+func (m *idea) searchParams(c *gin.Context) (service.SearchParams, error) {
+	params := service.SearchParams{
+		Query:    c.Query("query"),
+		Cursor:   c.Query("cursor"),
+		Semantic: c.Query("semantic"),
+		Hybrid:   c.Query("hybrid") == "true",
+		Fields:   queryList(c, "fields"),
+		UserID:   m.userID(c),
+		Rank:     c.Query("rank"),
+	}
+	if modes, tags := queryList(c, "prefer_modes"), queryList(c, "prefer_tags"); len(modes) > 0 || len(tags) > 0 {
+		params.Prefer = &service.UserProfile{
+			PreferModes: modes,
+			PreferTags:  tags,
 		}
 	}
+	// 未帶入的數值參數為 0，表示使用服務層的預設值
+	for key, target := range map[string]*int32{
+		"limit":     &params.Limit,
+		"page":      &params.Page,
+		"page_size": &params.PageSize,
+	} {
+		value, err := queryInt32(c, key)
+		if err != nil {
+			return params, err
+		}
+		*target = value
+	}
+	return params, nil
+}
 
-	// TODO: 從服務層獲取搜尋結果
-	manticoreClient, err := manticore.NewManticore()
+// search 執行搜尋並回應結果，索引未變更時回應 304
+func (m *idea) search(c *gin.Context, params service.SearchParams) {
+	svc, err := m.newIdeaService()
 	if err != nil {
 		m.GinErrorHandler(c, err)
 		return
 	}
-	svc := service.NewIdeaService(manticoreClient)
-	searchResponse, err := svc.SearchIdeas(query, scroll, limit)
+	// 索引未變更時不需要執行搜尋，但仍計入搜尋統計
+	start := time.Now()
+	if etag, modified, ok := svc.SearchETag(c.Request.Context(), params); ok {
+		setValidators(c, etag, modified)
+		if notModified(c.Request, etag, modified) {
+			svc.RecordNotModified(params, start)
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+	searchResponse, err := svc.SearchIdeas(c.Request.Context(), params)
 	if err != nil {
-		m.GinErrorHandler(c, err)
+		m.GinErrorHandler(c, serviceError(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, searchResponse)
 }
 
+// getIdea 回傳指定的 idea，並以版本產生的 ETag 與 updated_at 支援條件式請求
+func (m *idea) getIdea(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	data, err := svc.GetIdea(c.Request.Context(), id)
+	if err != nil {
+		m.GinErrorHandler(c, serviceError(err))
+		return
+	}
+
+	etag, modified := data.ETag(), time.Unix(data.Updated_at, 0)
+	setValidators(c, etag, modified)
+	c.Header(versionHeader, strconv.FormatInt(data.Version, 10))
+	if notModified(c.Request, etag, modified) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, data.Response())
+}
+
+// checkIfMatch 帶有 If-Match 時確認 idea 目前的 ETag 相符，並回傳比對時的版本供 service 在寫入時再次比對；
+// 不相符時回傳 412 並回傳 false，沒有 If-Match 時版本為 0
+func (m *idea) checkIfMatch(c *gin.Context, svc *service.IdeaService, id int64) (int64, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	current, err := svc.GetIdea(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, service.ErrIdeaNotFound):
+		m.GinErrorWithStatusHandler(c, http.StatusPreconditionFailed, fmt.Errorf("idea %d does not exist", id))
+		return 0, false
+	case err != nil:
+		m.GinErrorHandler(c, serviceError(err))
+		return 0, false
+	case !etagMatches(header, current.ETag(), false):
+		c.Header("ETag", current.ETag())
+		m.GinErrorWithStatusHandler(c, http.StatusPreconditionFailed, errors.New("idea has been modified"))
+		return 0, false
+	}
+	return current.Version, true
+}
+
+// expectedVersion 回傳寫入時要求的版本：優先使用客戶端指定的 version，否則使用 If-Match 比對時的版本，
+// 讓 service 在鎖定中比對，避免 If-Match 比對後、寫入前被其他寫入插入
+func expectedVersion(version int64, matched int64) int64 {
+	if version != 0 {
+		return version
+	}
+	return matched
+}
+
+// authorizeIdea 依 idea 目前的擁有者檢查 action，拒絕時回傳 403 並回傳 false；還原時讀取資源回收筒中的 idea。
+// 以 PUT 寫入不存在的 idea 視為新增，其他 action 遇到不存在的 idea 時交由後續的操作回傳 404
+func (m *idea) authorizeIdea(c *gin.Context, svc *service.IdeaService, id int64, action string) bool {
+	if m.policy == nil {
+		return true
+	}
+	read := svc.GetIdea
+	if action == authz.ActionRestore {
+		read = svc.TrashedIdea
+	}
+	current, err := read(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, service.ErrIdeaNotFound) && action == authz.ActionUpdate:
+		return m.authorize(c, authz.ActionCreate, m.userID(c))
+	case errors.Is(err, service.ErrIdeaNotFound):
+		return true
+	case err != nil:
+		m.GinErrorHandler(c, serviceError(err))
+		return false
+	}
+	return m.authorize(c, action, current.Owner_id)
+}
+
+// writeError 回應寫入 idea 的錯誤，版本衝突時以 versionHeader 回傳目前的版本；
+// 帶有 If-Match 的請求版本衝突時表示前提條件不再成立，回傳 412
+func (m *idea) writeError(c *gin.Context, err error) {
+	var conflict *service.ConflictError
+	if errors.As(err, &conflict) {
+		c.Header(versionHeader, strconv.FormatInt(conflict.Current, 10))
+		if c.GetHeader("If-Match") != "" {
+			m.GinErrorWithStatusHandler(c, http.StatusPreconditionFailed, errors.New("idea has been modified"))
+			return
+		}
+	}
+	m.GinErrorHandler(c, serviceError(err))
+}
+
+// toIdeaData 將 request 轉換為 IdeaData
+func toIdeaData(base request.BaseIdea) *model.IdeaData {
+	return &model.IdeaData{
+		ID:                 uint64(base.MongoId), // 使用 MongoId 作為 ID
+		Name:               base.ItineraryName,
+		Rewilding_name:     base.AttractionName,
+		Rewilding_mode:     base.WildMode,
+		Rewilding_location: base.AttractionLocation,
+		Tags:               strings.Join(base.Tags, ","), // 將標籤陣列轉為逗號分隔字串
+		Host_message:       base.HostMessage,
+		Experience_hours:   base.ExperienceDuration,
+		Publish_at:         base.PublishAt,
+		Expire_at:          base.ExpireAt,
+	}
+}
+
 func (m *idea) createIdea(c *gin.Context) {
 	// TODO
 	var requestBody request.CreateIdea
@@ -86,30 +310,24 @@ func (m *idea) createIdea(c *gin.Context) {
 		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
 		return
 	}
-	// 將 request 轉換為 IdeaData
-	ideaData := &model.IdeaData{
-		ID:                 uint64(requestBody.MongoId), // 使用 MongoId 作為 ID
-		Name:               requestBody.ItineraryName,
-		Rewilding_name:     requestBody.AttractionName,
-		Rewilding_mode:     requestBody.WildMode,
-		Rewilding_location: requestBody.AttractionLocation,
-		Tags:               strings.Join(requestBody.Tags, ","), // 將標籤陣列轉為逗號分隔字串
-		Host_message:       requestBody.HostMessage,
-		Experience_hours:   requestBody.ExperienceDuration,
+	if !m.authorize(c, authz.ActionCreate, m.userID(c)) {
+		return
 	}
+	// 將 request 轉換為 IdeaData
+	ideaData := toIdeaData(requestBody.BaseIdea)
+	ideaData.Owner_id = m.userID(c)
 
 	// 創建 Manticore client 和 service
-	manticoreClient, err := manticore.NewManticore()
+	svc, err := m.newIdeaService()
 	if err != nil {
 		m.GinErrorHandler(c, err)
 		return
 	}
-	svc := service.NewIdeaService(manticoreClient)
 
 	// 呼叫 service 創建 idea
-	id, err := svc.CreateIdea(ideaData)
+	id, err := svc.CreateIdea(c.Request.Context(), ideaData)
 	if err != nil {
-		m.GinErrorHandler(c, err)
+		m.GinErrorHandler(c, serviceError(err))
 		return
 	}
 	// 返回成功結果
@@ -118,10 +336,54 @@ func (m *idea) createIdea(c *gin.Context) {
 	})
 }
 
+// updateIdea 以 request 的內容取代指定的 idea，帶有 If-Match 時只在 ETag 相符時更新
 func (m *idea) updateIdea(c *gin.Context) {
-	fmt.Println("update idea")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+	var requestBody request.UpdateIdea
+	if err := c.BindJSON(&requestBody); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := requestBody.Validate(); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	if int64(requestBody.MongoId) != id {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, errors.New("mongo_id does not match the id in the path"))
+		return
+	}
+
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	if !m.authorizeIdea(c, svc, id, authz.ActionUpdate) {
+		return
+	}
+	matched, ok := m.checkIfMatch(c, svc, id)
+	if !ok {
+		return
+	}
+	ideaData := toIdeaData(requestBody.BaseIdea)
+	ideaData.Version = expectedVersion(requestBody.Version, matched)
+	// 新增時的擁有者，取代既有的 idea 時由 service 保留原本的擁有者
+	ideaData.Owner_id = m.userID(c)
+	if err := svc.ReplaceIdea(c.Request.Context(), id, ideaData); err != nil {
+		m.writeError(c, err)
+		return
+	}
+
+	setValidators(c, ideaData.ETag(), time.Unix(ideaData.Updated_at, 0))
+	c.Header(versionHeader, strconv.FormatInt(ideaData.Version, 10))
+	c.JSON(http.StatusOK, ideaData.Response())
 }
 
+// deleteIdea 將指定的 idea 移至資源回收筒，帶有 version 參數時只在版本相符時刪除
 func (m *idea) deleteIdea(c *gin.Context) {
 	// TODO
 	// 從 URL 參數獲取 ID
@@ -131,18 +393,183 @@ func (m *idea) deleteIdea(c *gin.Context) {
 		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
 		return
 	}
-	// TODO: manticore client跟service是否要從context獲得，比免重複創建
-	manticoreClient, err := manticore.NewManticore()
+	var version int64
+	if value := c.Query("version"); value != "" {
+		if version, err = strconv.ParseInt(value, 10, 64); err != nil || version < 0 {
+			m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid version: %s", value))
+			return
+		}
+	}
+	svc, err := m.newIdeaService()
 	if err != nil {
 		m.GinErrorHandler(c, err)
 		return
 	}
-	svc := service.NewIdeaService(manticoreClient)
+	if !m.authorizeIdea(c, svc, id, authz.ActionDelete) {
+		return
+	}
+	matched, ok := m.checkIfMatch(c, svc, id)
+	if !ok {
+		return
+	}
 
-	if err := svc.DeleteIdea(id); err != nil {
-		m.GinErrorHandler(c, err)
+	if err := svc.DeleteIdea(c.Request.Context(), id, expectedVersion(version, matched)); err != nil {
+		m.writeError(c, err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// transitionIdea 變更指定 idea 的狀態並回傳變更後的內容
+func (m *idea) transitionIdea(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+	var requestBody request.TransitionIdea
+	if err := c.BindJSON(&requestBody); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := requestBody.Validate(); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	if !m.authorizeIdea(c, svc, id, authz.ActionTransition+requestBody.Status) {
+		return
+	}
+	ideaData, err := svc.TransitionIdea(c.Request.Context(), id, requestBody.Status, requestBody.Version)
+	if err != nil {
+		m.writeError(c, err)
+		return
+	}
+
+	setValidators(c, ideaData.ETag(), time.Unix(ideaData.Updated_at, 0))
+	c.Header(versionHeader, strconv.FormatInt(ideaData.Version, 10))
+	c.JSON(http.StatusOK, ideaData.Response())
+}
+
+// getTrash 以頁碼分頁列出資源回收筒中的 idea，只有 moderator、admin 或 policy 允許 list_trash 的角色可以看到所有使用者的 idea
+func (m *idea) getTrash(c *gin.Context) {
+	page, err := queryInt32(c, "page")
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	pageSize, err := queryInt32(c, "page_size")
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	// 允許 list_trash 的角色列出所有使用者的 idea，其他使用者只列出自己的 idea
+	principal := m.principal(c)
+	if principal.ID == "" {
+		m.GinErrorWithStatusHandler(c, http.StatusUnauthorized, errors.New("authentication required"))
+		return
+	}
+	ownerID := principal.ID
+	if m.currentPolicy().Authorize(principal, authz.ActionListTrash, "") == nil {
+		ownerID = ""
+	}
+	searchResponse, err := svc.TrashIdeas(c.Request.Context(), ownerID, page, pageSize)
+	if err != nil {
+		m.GinErrorHandler(c, serviceError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, searchResponse)
+}
+
+// restoreIdea 將資源回收筒中的 idea 還原並回傳還原後的內容
+func (m *idea) restoreIdea(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	if !m.authorizeIdea(c, svc, id, authz.ActionRestore) {
+		return
+	}
+	ideaData, err := svc.RestoreIdea(c.Request.Context(), id)
+	if err != nil {
+		m.GinErrorHandler(c, serviceError(err))
+		return
+	}
+
+	setValidators(c, ideaData.ETag(), time.Unix(ideaData.Updated_at, 0))
+	c.Header(versionHeader, strconv.FormatInt(ideaData.Version, 10))
+	c.JSON(http.StatusOK, ideaData.Response())
+}
+
+func (m *idea) getSimilarIdeas(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return
+	}
+	limit, err := queryInt32(c, "limit")
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	// same_region=true 時只推薦相同地點的 idea
+	sameRegion := c.Query("same_region") == "true"
+
+	svc, err := m.newIdeaService()
+	if err != nil {
+		m.GinErrorHandler(c, err)
+		return
+	}
+	searchResponse, err := svc.SimilarIdeas(c.Request.Context(), id, limit, sameRegion)
+	if err != nil {
+		m.GinErrorHandler(c, serviceError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, searchResponse)
+}
+
+// queryInt32 解析整數的 query 參數，未帶入時回傳 0
+func queryInt32(c *gin.Context, key string) (int32, error) {
+	valueStr := c.Query(key)
+	if valueStr == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(valueStr, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return int32(value), nil
+}
+
+// queryList 解析以逗號分隔的 query 參數，忽略空白的值
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
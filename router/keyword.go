@@ -1,10 +1,11 @@
 package router
 
 import (
-	"fmt"
+	"log/slog"
 
 	"github.com/94peter/microservice/apitool"
 	"github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/pkg/logging"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,5 +29,5 @@ func (m *keyword) GetHandlers() []*apitool.GinHandler {
 }
 
 func (m *keyword) autocomplete(c *gin.Context) {
-	fmt.Println("autocomplete idea")
+	slog.DebugContext(c.Request.Context(), "autocomplete is not implemented", logging.KeyQuery, c.Query("query"))
 }
@@ -0,0 +1,27 @@
+package router
+
+import (
+	"github.com/94peter/microservice/apitool"
+	"github.com/94peter/microservice/apitool/err"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type metricsAPI struct {
+	err.CommonErrorHandler
+	path string
+}
+
+func newMetrics(path string) apitool.GinAPI {
+	return &metricsAPI{path: path}
+}
+
+func (m *metricsAPI) GetHandlers() []*apitool.GinHandler {
+	return []*apitool.GinHandler{
+		{
+			Path:    m.path,
+			Method:  "GET",
+			Handler: gin.WrapH(promhttp.Handler()),
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/pkg/auth"
+	"github.com/arwoosa/post/pkg/logging"
+	"github.com/arwoosa/post/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader 客戶端的 API key，只有設定在 ratelimit.api_keys 中的 key 會被採用
+const apiKeyHeader = "X-Api-Key"
+
+// rateLimitMiddle 以 token bucket 限制每個 client 在 search、write 與 autocomplete 的請求
+type rateLimitMiddle struct {
+	err.CommonErrorHandler
+	limiter *ratelimit.Limiter
+	// verifier 不為 nil 時以驗證過的 token 的 sub 識別使用者，為 nil 時不識別使用者
+	verifier *auth.Verifier
+	// apiKeys 有效 API key 的雜湊
+	apiKeys map[string]bool
+	// trustedProxies 可信任其 X-Forwarded-For 的 proxy，為空時只以連線的位址識別 client
+	trustedProxies []*net.IPNet
+}
+
+func newRateLimitMiddle(limiter *ratelimit.Limiter, verifier *auth.Verifier, apiKeys []string, trustedProxies []*net.IPNet) *rateLimitMiddle {
+	m := &rateLimitMiddle{
+		limiter:        limiter,
+		verifier:       verifier,
+		apiKeys:        make(map[string]bool, len(apiKeys)),
+		trustedProxies: trustedProxies,
+	}
+	for _, key := range apiKeys {
+		m.apiKeys[hashAPIKey(key)] = true
+	}
+	return m
+}
+
+func (m *rateLimitMiddle) Handler() gin.HandlerFunc {
+	return m.limit
+}
+
+// limit 取出 token 並回傳 RateLimit-* 標頭，額度用完時回傳 429 與 Retry-After；
+// store 發生錯誤時記錄後放行，避免限制元件故障時整個服務無法使用
+func (m *rateLimitMiddle) limit(c *gin.Context) {
+	budget := budgetOf(c)
+	if budget == "" {
+		c.Next()
+		return
+	}
+	result, limited, err := m.limiter.Take(c.Request.Context(), budget, m.clientKey(c))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "take rate limit token failed", logging.KeyError, err.Error())
+		c.Next()
+		return
+	}
+	if !limited {
+		c.Next()
+		return
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		m.GinErrorWithStatusHandler(c, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded for %s, retry after %ds", budget, retryAfter))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// budgetOf 回傳路由所屬的 budget，不限制的路由回傳空字串
+func budgetOf(c *gin.Context) string {
+	route := c.FullPath()
+	switch {
+	case route == "/keyword/autocomplete":
+		return ratelimit.BudgetAutocomplete
+	case route == "/search/events":
+		return ratelimit.BudgetWrite
+	// 管理用的搜尋與統計會掃描整個索引或所有搜尋紀錄
+	case route == "/admin/idea" || route == "/admin/search/stats":
+		return ratelimit.BudgetSearch
+	case route != "/idea" && !strings.HasPrefix(route, "/idea/"):
+		return ""
+	case c.Request.Method == http.MethodGet:
+		return ratelimit.BudgetSearch
+	default:
+		return ratelimit.BudgetWrite
+	}
+}
+
+// clientKey 依序以有效的 API key、驗證過的使用者、IP 識別 client；
+// 客戶端可任意變更的標頭不作為 key，避免每次請求更換標頭取得新的 bucket
+func (m *rateLimitMiddle) clientKey(c *gin.Context) string {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		if hash := hashAPIKey(key); m.apiKeys[hash] {
+			return "key:" + hash
+		}
+	}
+	if user := m.user(c); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + m.clientIP(c)
+}
+
+// clientIP 回傳連線的位址；連線來自 trusted proxy 時，由右至左取 X-Forwarded-For 中
+// 第一個不是 trusted proxy 的位址
+func (m *rateLimitMiddle) clientIP(c *gin.Context) string {
+	return clientIP(c, m.trustedProxies)
+}
+
+// clientIP 回傳連線的位址；連線來自 proxies 之一時，由右至左取 X-Forwarded-For 中
+// 第一個不是 proxies 的位址。不使用 gin 的 ClientIP，因為 engine 預設信任所有 proxy，
+// 客戶端可任意偽造 X-Forwarded-For
+func clientIP(c *gin.Context, proxies []*net.IPNet) string {
+	ip := c.RemoteIP()
+	if !trustedProxy(proxies, ip) {
+		return ip
+	}
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxy(proxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy 判斷 ip 是否屬於 proxies
+func trustedProxy(proxies []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// user 回傳有效 token 的 sub，未啟用驗證或 token 無效時回傳空字串
+func (m *rateLimitMiddle) user(c *gin.Context) string {
+	if m.verifier == nil {
+		return ""
+	}
+	token, err := auth.BearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return ""
+	}
+	claims, err := m.verifier.Verify(token)
+	if err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+// hashAPIKey 回傳 API key 的雜湊，避免在 store 中保存原始的 API key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ceilSeconds 將 d 無條件進位為秒數，供 RateLimit-Reset 與 Retry-After 使用
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,34 @@
+package request
+
+import "errors"
+
+// MaxSearchEvents 每次請求最多可回報的事件數量
+const MaxSearchEvents = 100
+
+// SearchEvent 搜尋結果上的使用者互動事件
+type SearchEvent struct {
+	// Type 為 impression、click 或 bookmark
+	Type     string `json:"type"`
+	Query    string `json:"query"`
+	IdeaID   uint64 `json:"idea_id"`
+	Position int32  `json:"position"`
+}
+
+// SearchEvents 批次回報的搜尋事件
+type SearchEvents struct {
+	Events []SearchEvent `json:"events"`
+}
+
+// Validate 驗證事件數量，個別事件的內容由服務層驗證
+func (r *SearchEvents) Validate() error {
+	if r == nil {
+		return errors.New("nil request")
+	}
+	if len(r.Events) == 0 {
+		return errors.New("empty events")
+	}
+	if len(r.Events) > MaxSearchEvents {
+		return errors.New("too many events")
+	}
+	return nil
+}
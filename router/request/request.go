@@ -3,6 +3,7 @@ package request
 import (
 	"errors"
 	"strings"
+	"time"
 )
 
 // BaseIdea 包含所有共用的欄位
@@ -15,12 +16,54 @@ type BaseIdea struct {
 	AttractionLocation string   `json:"attraction_location"`
 	HostMessage        string   `json:"host_message"`
 	ExperienceDuration float64  `json:"experience_duration"`
+	// PublishAt 與 ExpireAt 公開搜尋顯示的期間 (Unix 秒)，0 表示不限制
+	PublishAt int64 `json:"publish_at"`
+	ExpireAt  int64 `json:"expire_at"`
 }
 type CreateIdea struct {
 	BaseIdea
 }
+
+// Validate 驗證基礎欄位，並拒絕已經到期的 expire_at；更新時允許保留過去的 expire_at，以便編輯已下架的 idea
+func (r *CreateIdea) Validate() error {
+	if r == nil {
+		return errors.New("nil request")
+	}
+	if err := r.BaseIdea.Validate(); err != nil {
+		return err
+	}
+	if r.ExpireAt > 0 && r.ExpireAt <= time.Now().Unix() {
+		return errors.New("expire_at must be in the future")
+	}
+	return nil
+}
+
 type UpdateIdea struct {
 	BaseIdea
+	// Version 編輯者讀取時的版本，與目前的版本不同時回傳 409，為 0 時不檢查
+	Version int64 `json:"version"`
+}
+
+// TransitionIdea 變更 idea 狀態的 request
+type TransitionIdea struct {
+	// Status 目標狀態，例如 pending_review、published
+	Status string `json:"status"`
+	// Version 讀取時的版本，與目前的版本不同時回傳 409，為 0 時不檢查
+	Version int64 `json:"version"`
+}
+
+// Validate 驗證狀態不為空，狀態是否合法由 service 層檢查
+func (t *TransitionIdea) Validate() error {
+	if t == nil {
+		return errors.New("nil request")
+	}
+	if strings.TrimSpace(t.Status) == "" {
+		return errors.New("empty status")
+	}
+	if t.Version < 0 {
+		return errors.New("version must not be negative")
+	}
+	return nil
 }
 
 // Validate 驗證基礎欄位
@@ -60,5 +103,13 @@ func (b *BaseIdea) Validate() error {
 		return errors.New("experience_duration smaller than or equal to zero")
 	}
 
+	if b.PublishAt < 0 || b.ExpireAt < 0 {
+		return errors.New("publish_at and expire_at must not be negative")
+	}
+
+	if b.ExpireAt > 0 && b.ExpireAt <= b.PublishAt {
+		return errors.New("expire_at must be later than publish_at")
+	}
+
 	return nil
 }
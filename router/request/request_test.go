@@ -2,8 +2,70 @@ package request
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
+func validBaseIdea() BaseIdea {
+	return BaseIdea{
+		MongoId:            1,
+		ItineraryName:      "森林步道",
+		AttractionName:     "太平山",
+		Tags:               []string{"新手"},
+		WildMode:           "露營",
+		AttractionLocation: "宜蘭, 台灣",
+		HostMessage:        "歡迎參加",
+		ExperienceDuration: 4,
+	}
+}
+
 func TestCreateIdeaValidate(t *testing.T) {
-	// TODO: Write test
+	future := time.Now().Add(24 * time.Hour).Unix()
+	past := time.Now().Add(-24 * time.Hour).Unix()
+	tests := []struct {
+		name      string
+		publishAt int64
+		expireAt  int64
+		valid     bool
+	}{
+		{name: "no schedule", valid: true},
+		{name: "publish only", publishAt: future, valid: true},
+		{name: "expire only", expireAt: future, valid: true},
+		{name: "publish before expire", publishAt: future, expireAt: future + 3600, valid: true},
+		{name: "expire before publish", publishAt: future, expireAt: future - 3600},
+		{name: "expire at publish", publishAt: future, expireAt: future},
+		{name: "past expiry", expireAt: past},
+		{name: "negative publish", publishAt: -1},
+		{name: "negative expire", expireAt: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := CreateIdea{BaseIdea: validBaseIdea()}
+			request.PublishAt = test.publishAt
+			request.ExpireAt = test.expireAt
+			if test.valid {
+				assert.NoError(t, request.Validate())
+			} else {
+				assert.Error(t, request.Validate())
+			}
+		})
+	}
+
+	request := CreateIdea{BaseIdea: validBaseIdea()}
+	request.ItineraryName = " "
+	assert.Error(t, request.Validate())
+	var empty *CreateIdea
+	assert.Error(t, empty.Validate())
+}
+
+func TestUpdateIdeaValidate(t *testing.T) {
+	// 編輯已下架的 idea 時可以保留過去的 expire_at
+	request := UpdateIdea{BaseIdea: validBaseIdea()}
+	request.PublishAt = time.Now().Add(-48 * time.Hour).Unix()
+	request.ExpireAt = time.Now().Add(-24 * time.Hour).Unix()
+	assert.NoError(t, request.Validate())
+
+	request.ExpireAt = request.PublishAt
+	assert.Error(t, request.Validate())
 }
@@ -1,14 +1,191 @@
 package router
 
 import (
+	"net"
+
 	"github.com/94peter/microservice/apitool"
+	"github.com/94peter/microservice/apitool/mid"
+	"github.com/arwoosa/post/pkg/auth"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/arwoosa/post/pkg/logging"
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/arwoosa/post/pkg/metrics"
+	"github.com/arwoosa/post/pkg/ratelimit"
+	"github.com/arwoosa/post/service"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func GetApis() []apitool.GinAPI {
+// options GetApis 建立 API 時使用的共用元件
+type options struct {
+	// client 所有 API 共用的 Manticore client，未指定時每個請求各自創建
+	client    manticore.ManticoreService
+	events    *service.EventService
+	analytics *service.SearchAnalytics
+	cache     *service.SearchCache
+	version   service.IndexVersion
+	// verifier 不為 nil 時，標示為 authenticated 的路由需要帶有效的 JWT
+	verifier *auth.Verifier
+	// policy 不為 nil 時，新增、更新、刪除與變更狀態需符合角色與擁有者的權限
+	policy *authz.Policy
+	// limiter 不為 nil 時限制每個 client 在 search、write 與 autocomplete 的請求
+	limiter *ratelimit.Limiter
+	// apiKeys 以 X-Api-Key 各自計算額度的有效 API key
+	apiKeys []string
+	// trustedProxies rate limit 與搜尋事件去重以 IP 識別 client 時，可信任其 X-Forwarded-For 的 proxy
+	trustedProxies []*net.IPNet
+	// metricsPath 不為空時提供 Prometheus 指標
+	metricsPath string
+	// tracingService 不為空時為每個請求建立 span
+	tracingService string
+}
+
+// Option 設定 GetApis 建立 API 時使用的共用元件
+type Option func(*options)
+
+// WithManticore 指定所有 API 共用的 Manticore client，斷路器等狀態才能跨請求保留
+func WithManticore(client manticore.ManticoreService) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithEventService 指定記錄搜尋事件的 EventService，未指定時 POST /search/events 回傳 503
+func WithEventService(events *service.EventService) Option {
+	return func(o *options) {
+		o.events = events
+	}
+}
+
+// WithSearchAnalytics 指定記錄搜尋的 SearchAnalytics，未指定時 GET /admin/search/stats 回傳 503
+func WithSearchAnalytics(analytics *service.SearchAnalytics) Option {
+	return func(o *options) {
+		o.analytics = analytics
+	}
+}
+
+// WithSearchCache 指定快取 GET /idea 搜尋結果的 SearchCache，未指定時不快取
+func WithSearchCache(cache *service.SearchCache) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithIndexVersion 指定 idea 表的 IndexVersion，未指定時 GET /idea 不提供 ETag
+func WithIndexVersion(version service.IndexVersion) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+// WithAuth 以 verifier 驗證寫入與管理路由的 Bearer token，未指定時不驗證，由 API gateway 負責
+func WithAuth(verifier *auth.Verifier) Option {
+	return func(o *options) {
+		o.verifier = verifier
+	}
+}
+
+// WithPolicy 以 policy 檢查 idea 的新增、更新、刪除與變更狀態，未指定時不檢查權限
+func WithPolicy(policy *authz.Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// WithRateLimit 以 limiter 限制每個 client 在 search、write 與 autocomplete 的請求，未指定時不限制；
+// 帶有 apiKeys 其中之一的請求以 API key 計算額度，其他請求以驗證過的使用者或 IP 計算
+func WithRateLimit(limiter *ratelimit.Limiter, apiKeys ...string) Option {
+	return func(o *options) {
+		o.limiter = limiter
+		o.apiKeys = apiKeys
+	}
+}
+
+// WithTrustedProxies 讓 rate limit 與搜尋事件去重信任來自 proxies 的 X-Forwarded-For，
+// 未指定時以連線的位址識別 client，服務在 load balancer 之後時需要設定
+func WithTrustedProxies(proxies ...*net.IPNet) Option {
+	return func(o *options) {
+		o.trustedProxies = proxies
+	}
+}
+
+// WithMetrics 在 path 提供 Prometheus 指標，並記錄每個路由的請求
+func WithMetrics(path string) Option {
+	return func(o *options) {
+		o.metricsPath = path
+	}
+}
+
+// WithTracing 為每個請求建立以路由命名的 span，並接續請求標頭中的 W3C trace context
+func WithTracing(service string) Option {
+	return func(o *options) {
+		o.tracingService = service
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// manticoreClient 回傳共用的 client，未指定時創建記錄錯誤與指標的 client
+func manticoreClient(shared manticore.ManticoreService) (manticore.ManticoreService, error) {
+	if shared != nil {
+		return shared, nil
+	}
+	client, err := manticore.NewManticore()
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Manticore(logging.Manticore(client)), nil
+}
+
+func GetApis(opts ...Option) []apitool.GinAPI {
+	o := newOptions(opts)
+
+	var ideaOpts []service.IdeaServiceOption
+	if o.analytics != nil {
+		ideaOpts = append(ideaOpts, service.WithSearchRecorder(o.analytics))
+	}
+	if o.cache != nil {
+		ideaOpts = append(ideaOpts, service.WithSearchCache(o.cache))
+	}
+	if o.version != nil {
+		ideaOpts = append(ideaOpts, service.WithIndexVersion(o.version))
+	}
+
 	apis := []apitool.GinAPI{
-		newIdea(),
+		newIdea(o.client, securedAPI{verifier: o.verifier, policy: o.policy}, ideaOpts...),
 		newKeyword(),
+		newSearch(o.events, o.analytics, securedAPI{verifier: o.verifier, policy: o.policy}, o.trustedProxies),
+		newHealth(o.client),
+	}
+	if o.metricsPath != "" {
+		metrics.Register()
+		apis = append(apis, newMetrics(o.metricsPath))
 	}
 
 	return apis
 }
+
+// GetMiddles 回傳套用到所有路由的中介層，請求 ID 與請求紀錄永遠是第一個
+func GetMiddles(opts ...Option) []mid.GinMiddle {
+	o := newOptions(opts)
+
+	middles := []mid.GinMiddle{
+		mid.NewGinMiddle(logging.GinHandler(o.metricsPath, livenessPath, readinessPath)),
+	}
+	if o.tracingService != "" {
+		middles = append(middles, mid.NewGinMiddle(otelgin.Middleware(o.tracingService)))
+	}
+	if o.metricsPath != "" {
+		middles = append(middles, mid.NewGinMiddle(metrics.GinHandler(o.metricsPath)))
+	}
+	// 放在請求紀錄與指標之後，被限制的請求也會被記錄
+	if o.limiter != nil {
+		middles = append(middles, newRateLimitMiddle(o.limiter, o.verifier, o.apiKeys, o.trustedProxies))
+	}
+	return middles
+}
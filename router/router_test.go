@@ -2,16 +2,34 @@ package router
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/94peter/microservice/apitool"
 	apiErr "github.com/94peter/microservice/apitool/err"
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/auth"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/arwoosa/post/pkg/eventlog"
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/arwoosa/post/pkg/ratelimit"
 	"github.com/arwoosa/post/router/request"
+	"github.com/arwoosa/post/service"
 	"github.com/gin-gonic/gin"
+	Manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +42,9 @@ func TestGetApis(t *testing.T) {
 			name: "test GetApis",
 			want: []apitool.GinAPI{
 				&idea{},
+				&keyword{},
+				&search{},
+				&health{},
 			},
 		},
 	}
@@ -32,7 +53,7 @@ func TestGetApis(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			got := GetApis()
 			if len(got) != len(tt.want) {
-				t.Errorf("GetApis() = %v, want %v", got, tt.want)
+				t.Fatalf("GetApis() = %v, want %v", got, tt.want)
 			}
 			for i, api := range got {
 				if fmt.Sprintf("%T", api) != fmt.Sprintf("%T", tt.want[i]) {
@@ -47,34 +68,28 @@ func TestIdeaGetHandlers(t *testing.T) {
 
 	handlers := m.GetHandlers()
 
-	// Test that the function returns five handlers
-	if len(handlers) != 5 {
-		t.Errorf("expected 5 handlers, got %d", len(handlers))
-	}
-
-	// Test that the first handler has the correct path and method
-	if handlers[0].Path != "/idea" || handlers[0].Method != "GET" {
-		t.Errorf("expected first handler to have path '/idea' and method 'GET', got path '%s' and method '%s'", handlers[0].Path, handlers[0].Method)
-	}
-
-	// Test that the second handler has the correct path and method
-	if handlers[1].Path != "/idea" || handlers[1].Method != "POST" {
-		t.Errorf("expected second handler to have path '/idea' and method 'POST', got path '%s' and method '%s'", handlers[1].Path, handlers[1].Method)
-	}
-
-	// Test that the third handler has the correct path and method
-	if handlers[2].Path != "/idea/:id" || handlers[2].Method != "PUT" {
-		t.Errorf("expected third handler to have path '/idea/:id' and method 'PUT', got path '%s' and method '%s'", handlers[2].Path, handlers[2].Method)
+	want := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/idea"},
+		{"POST", "/idea"},
+		{"GET", "/idea/trash"},
+		{"GET", "/idea/:id"},
+		{"PUT", "/idea/:id"},
+		{"DELETE", "/idea/:id"},
+		{"POST", "/idea/:id/restore"},
+		{"POST", "/idea/:id/status"},
+		{"GET", "/idea/:id/similar"},
+		{"GET", "/admin/idea"},
 	}
-
-	// Test that the forth handler has the correct path and method
-	if handlers[3].Path != "/idea/:id" || handlers[3].Method != "DELETE" {
-		t.Errorf("expected forth handler to have path '/idea/:id' and method 'DELETE', got path '%s' and method '%s'", handlers[3].Path, handlers[3].Method)
+	if len(handlers) != len(want) {
+		t.Fatalf("expected %d handlers, got %d", len(want), len(handlers))
 	}
-
-	// Test that the fifth handler has the correct path and method
-	if handlers[4].Path != "/idea/autocomplete" || handlers[4].Method != "GET" {
-		t.Errorf("expected fifth handler to have path '/idea/autocomplete' and method 'GET', got path '%s' and method '%s'", handlers[4].Path, handlers[4].Method)
+	for i, handler := range handlers {
+		if handler.Path != want[i].path || handler.Method != want[i].method {
+			t.Errorf("expected handler %d to have path '%s' and method '%s', got path '%s' and method '%s'", i, want[i].path, want[i].method, handler.Path, handler.Method)
+		}
 	}
 }
 func TestCreateIdea(t *testing.T) {
@@ -86,7 +101,6 @@ func TestCreateIdea(t *testing.T) {
 		mockInsertFunc  func(query string) error
 		mockInsertError error
 		statusCode      int
-		response        *request.CreateIdeaResponse
 	}{
 		{
 			name:           "bind error",
@@ -122,21 +136,7 @@ func TestCreateIdea(t *testing.T) {
 				// 模擬 SQL 插入成功
 				return nil
 			},
-			statusCode: http.StatusOK,
-			response: &request.CreateIdeaResponse{
-				BaseIdeaResponse: request.BaseIdeaResponse{
-					BaseIdea: request.BaseIdea{
-						MongoId:            1,
-						ItineraryName:      "自行車地獄之旅",
-						AttractionName:     "河濱公園",
-						Tags:               []string{"新手", "情侶", "一日遊", "文化體驗", "期間限定"},
-						WildMode:           "露營",
-						AttractionLocation: "台北, 台灣",
-						HostMessage:        "這是一個很棒的行程，歡迎參加",
-						ExperienceDuration: 4.0,
-					},
-				},
-			},
+			statusCode: http.StatusCreated,
 		},
 		{
 			name: "server error",
@@ -154,7 +154,7 @@ func TestCreateIdea(t *testing.T) {
 			},
 			mockInsertFunc: func(query string) error {
 				// 模擬 SQL 插入失敗
-				return nil
+				return fmt.Errorf("internal server error")
 			},
 			statusCode: http.StatusInternalServerError,
 		},
@@ -179,16 +179,14 @@ func TestCreateIdea(t *testing.T) {
 			c.Request, _ = http.NewRequest("POST", "/ideas", requestData)
 			c.Request.Header.Set("Content-Type", "application/json")
 
-			/* setup mock
-
+			// setup mock
 			mockDatabaseInsert := func(query string) error {
 				if test.mockInsertFunc != nil {
 					return test.mockInsertFunc(query)
 				}
 				return test.mockInsertError
 			}
-
-			*/
+			newMockManticore(t, mockDatabaseInsert)
 
 			idea := &idea{}
 			idea.SetErrorHandler(func(c *gin.Context, err error) {
@@ -196,6 +194,7 @@ func TestCreateIdea(t *testing.T) {
 					c.JSON(apiErr.GetStatus(), gin.H{
 						"error": apiErr.Error(),
 					})
+					return
 				}
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": err.Error(),
@@ -204,8 +203,8 @@ func TestCreateIdea(t *testing.T) {
 			idea.createIdea(c)
 
 			assert.Equal(t, test.statusCode, w.Code)
-			if test.response != nil {
-				assert.Equal(t, test.response, w.Result())
+			if test.statusCode == http.StatusCreated {
+				assert.JSONEq(t, `{"id":1}`, w.Body.String())
 			}
 		})
 	}
@@ -220,7 +219,6 @@ func TestUpdateIdea(t *testing.T) {
 		mockUpdateFunc  func(query string) error
 		mockUpdateError error
 		statusCode      int
-		response        *request.UpdateIdeaResponse
 	}{
 		{
 			name:        "bind error",
@@ -258,24 +256,11 @@ func TestUpdateIdea(t *testing.T) {
 				return nil
 			},
 			statusCode: http.StatusOK,
-			response: &request.UpdateIdeaResponse{
-				BaseIdeaResponse: request.BaseIdeaResponse{
-					BaseIdea: request.BaseIdea{
-						MongoId:            1,
-						ItineraryName:      "更新後的行程名稱",
-						AttractionName:     "更新後的景點名稱",
-						Tags:               []string{"更新標籤一", "更新標籤二"},
-						WildMode:           "更新後的野放模式",
-						AttractionLocation: "更新後的景點縣市",
-						HostMessage:        "這是團主想說的話",
-						ExperienceDuration: 3.5,
-					},
-				},
-			},
 		},
 		{
-			name:    "not found error",
-			mongoId: "999",
+			// PUT 不存在的 idea 時會新增，路徑與 mongo_id 不符時才拒絕
+			name:    "mongo_id mismatch",
+			mongoId: "1",
 			requestBody: &request.UpdateIdea{
 				BaseIdea: request.BaseIdea{
 					MongoId:            999,
@@ -288,11 +273,7 @@ func TestUpdateIdea(t *testing.T) {
 					ExperienceDuration: 3.5,
 				},
 			},
-			mockUpdateFunc: func(query string) error {
-				// 模擬找不到資料
-				return fmt.Errorf("idea not found")
-			},
-			statusCode: http.StatusNotFound,
+			statusCode: http.StatusBadRequest,
 		},
 		{
 			name:    "server error",
@@ -337,16 +318,14 @@ func TestUpdateIdea(t *testing.T) {
 			c.Request.Header.Set("Content-Type", "application/json")
 			c.Params = []gin.Param{{Key: "id", Value: test.mongoId}}
 
-			/* setup mock
-
+			// setup mock
 			mockDatabaseUpdate := func(query string) error {
 				if test.mockUpdateFunc != nil {
 					return test.mockUpdateFunc(query)
 				}
 				return test.mockUpdateError
 			}
-
-			*/
+			newMockManticore(t, mockDatabaseUpdate)
 
 			idea := &idea{}
 			idea.SetErrorHandler(func(c *gin.Context, err error) {
@@ -354,6 +333,7 @@ func TestUpdateIdea(t *testing.T) {
 					c.JSON(apiErr.GetStatus(), gin.H{
 						"error": apiErr.Error(),
 					})
+					return
 				}
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": err.Error(),
@@ -362,8 +342,11 @@ func TestUpdateIdea(t *testing.T) {
 			idea.updateIdea(c)
 
 			assert.Equal(t, test.statusCode, w.Code)
-			if test.response != nil {
-				assert.Equal(t, test.response, w.Result())
+			if test.statusCode == http.StatusOK {
+				var body model.IdeaResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, test.requestBody.ItineraryName, body.Name)
+				assert.Equal(t, test.requestBody.Tags, body.Tags)
 			}
 		})
 	}
@@ -390,11 +373,9 @@ func TestDeleteIdea(t *testing.T) {
 		{
 			name:    "not found error",
 			mongoId: "999",
-			mockDeleteFunc: func(query string) error {
-				// 模擬找不到資料
-				return fmt.Errorf("idea not found")
-			},
-			statusCode: http.StatusNotFound,
+			// 模擬找不到資料，mock 中只有 id 為 1 的 idea
+			mockDeleteFunc: nil,
+			statusCode:     http.StatusNotFound,
 		},
 		{
 			name:    "server error",
@@ -415,16 +396,15 @@ func TestDeleteIdea(t *testing.T) {
 			c.Request, _ = http.NewRequest("DELETE", "/idea/"+test.mongoId, nil)
 			c.Params = []gin.Param{{Key: "id", Value: test.mongoId}}
 
-			/* setup mock
-
+			// setup mock
 			mockDatabaseDelete := func(query string) error {
 				if test.mockDeleteFunc != nil {
 					return test.mockDeleteFunc(query)
 				}
 				return test.mockDeleteError
 			}
-
-			*/
+			docs := newMockManticore(t, mockDatabaseDelete)
+			docs[1] = map[string]interface{}{"name": "森林步道", "version": 1}
 
 			idea := &idea{}
 			idea.SetErrorHandler(func(c *gin.Context, err error) {
@@ -432,17 +412,1039 @@ func TestDeleteIdea(t *testing.T) {
 					c.JSON(apiErr.GetStatus(), gin.H{
 						"error": apiErr.Error(),
 					})
+					return
 				}
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": err.Error(),
 				})
 			})
 			idea.deleteIdea(c)
+			// 204 沒有 body，需要手動寫出狀態碼
+			c.Writer.WriteHeaderNow()
 
 			assert.Equal(t, test.statusCode, w.Code)
 		})
 	}
 }
+
+// newMockManticore 啟動模擬 Manticore HTTP API 的 server 並將 manticore.url 指向它，
+// 回傳 server 保存的文件；mock 收到請求的 body，回傳錯誤時 server 回應 500
+func newMockManticore(t *testing.T, mock func(query string) error) map[int64]map[string]interface{} {
+	docs := map[int64]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := mock(string(body)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var req struct {
+			ID    int64                  `json:"id"`
+			Doc   map[string]interface{} `json:"doc"`
+			Query struct {
+				Equals map[string]int64 `json:"equals"`
+			} `json:"query"`
+		}
+		_ = json.Unmarshal(body, &req)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/insert":
+			id := int64(len(docs) + 1)
+			docs[id] = req.Doc
+			fmt.Fprintf(w, `{"table":"idea","id":%d,"created":true,"result":"created","status":201}`, id)
+		case "/replace":
+			docs[req.ID] = req.Doc
+			fmt.Fprintf(w, `{"table":"idea","id":%d,"created":false,"result":"updated","status":200}`, req.ID)
+		case "/update":
+			for key, value := range req.Doc {
+				docs[req.ID][key] = value
+			}
+			fmt.Fprintf(w, `{"table":"idea","id":%d,"updated":1,"result":"updated"}`, req.ID)
+		case "/delete":
+			delete(docs, req.ID)
+			fmt.Fprintf(w, `{"table":"idea","id":%d,"deleted":1,"found":true,"result":"deleted"}`, req.ID)
+		case "/search":
+			hits := []map[string]interface{}{}
+			if doc, ok := docs[req.Query.Equals["id"]]; ok {
+				hits = append(hits, map[string]interface{}{"_id": req.Query.Equals["id"], "_source": doc})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"hits": map[string]interface{}{"total": len(hits), "hits": hits}})
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	viper.Set("manticore.url", server.URL)
+	t.Cleanup(func() { viper.Set("manticore.url", "") })
+	return docs
+}
+
 func TestAutocomplete(t *testing.T) {
 	// TODO: Write test
 }
+
+func TestRecordSearchEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, err := eventlog.NewStore(filepath.Join(t.TempDir(), "events.log"), 100, time.Hour)
+	assert.NoError(t, err)
+	events := service.NewEventService(nil, store)
+
+	tests := []struct {
+		name        string
+		events      *service.EventService
+		requestBody *request.SearchEvents
+		statusCode  int
+	}{
+		{
+			name:        "tracking disabled",
+			requestBody: &request.SearchEvents{Events: []request.SearchEvent{{Type: "click", IdeaID: 1, Position: 1}}},
+			statusCode:  http.StatusServiceUnavailable,
+		},
+		{
+			name:       "bind error",
+			events:     events,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:        "empty events",
+			events:      events,
+			requestBody: &request.SearchEvents{},
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "unknown event type",
+			events:      events,
+			requestBody: &request.SearchEvents{Events: []request.SearchEvent{{Type: "purchase", IdeaID: 1, Position: 1}}},
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:   "valid request",
+			events: events,
+			requestBody: &request.SearchEvents{Events: []request.SearchEvent{
+				{Type: "impression", Query: "露營", IdeaID: 1, Position: 1},
+				{Type: "click", Query: "露營", IdeaID: 1, Position: 1},
+			}},
+			statusCode: http.StatusAccepted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			requestData := bytes.NewBuffer([]byte{})
+			if test.requestBody != nil {
+				data, _ := json.Marshal(test.requestBody)
+				requestData = bytes.NewBuffer(data)
+			}
+			c.Request, _ = http.NewRequest("POST", "/search/events", requestData)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			search := newSearch(test.events, nil, securedAPI{}, nil).(*search)
+			search.SetErrorHandler(func(c *gin.Context, err error) {
+				if apiErr, ok := err.(apiErr.ApiError); ok {
+					c.JSON(apiErr.GetStatus(), gin.H{
+						"error": apiErr.Error(),
+					})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+			})
+			search.recordEvents(c)
+
+			assert.Equal(t, test.statusCode, w.Code)
+		})
+	}
+}
+
+func TestGetSearchStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	analytics := service.NewSearchAnalytics()
+	analytics.RecordSearch(service.SearchRecord{Query: "露營", Latency: time.Millisecond, At: time.Now()})
+
+	tests := []struct {
+		name       string
+		analytics  *service.SearchAnalytics
+		query      string
+		header     map[string]string
+		statusCode int
+		searches   int
+	}{
+		{
+			name:       "analytics disabled",
+			statusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "missing user",
+			analytics:  analytics,
+			header:     map[string]string{},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "host",
+			analytics:  analytics,
+			header:     map[string]string{userIDHeader: "host-1", rolesHeader: "host"},
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "invalid window",
+			analytics:  analytics,
+			query:      "window=yesterday",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid limit",
+			analytics:  analytics,
+			query:      "limit=1000",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "valid request",
+			analytics:  analytics,
+			query:      "window=1h&limit=5",
+			statusCode: http.StatusOK,
+			searches:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/admin/search/stats?"+test.query, nil)
+			header := test.header
+			if header == nil {
+				header = map[string]string{userIDHeader: "moderator-1", rolesHeader: authz.RoleModerator}
+			}
+			for key, value := range header {
+				c.Request.Header.Set(key, value)
+			}
+
+			search := newSearch(nil, test.analytics, securedAPI{}, nil).(*search)
+			search.SetErrorHandler(func(c *gin.Context, err error) {
+				if apiErr, ok := err.(apiErr.ApiError); ok {
+					c.JSON(apiErr.GetStatus(), gin.H{
+						"error": apiErr.Error(),
+					})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+			})
+			search.getStats(c)
+
+			assert.Equal(t, test.statusCode, w.Code)
+			if test.statusCode == http.StatusOK {
+				var stats service.SearchStats
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+				assert.Equal(t, test.searches, stats.Searches)
+			}
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/healthz", nil)
+
+	health := newHealth(nil).(*health)
+	health.liveness(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+// memoryManticore 以 map 保存文件的 manticore.ManticoreService，Search 回傳所有文件
+type memoryManticore struct {
+	docs     map[int64]map[string]interface{}
+	searches int
+	// lastSearch 最後一次的搜尋請求，搜尋結果不套用其中的條件
+	lastSearch *Manticoresearch.SearchRequest
+}
+
+func newMemoryManticore() *memoryManticore {
+	return &memoryManticore{docs: map[int64]map[string]interface{}{}}
+}
+
+func (m *memoryManticore) Create(ctx context.Context, index string, data map[string]interface{}) (int64, error) {
+	id := int64(len(m.docs) + 1)
+	m.docs[id] = data
+	return id, nil
+}
+
+func (m *memoryManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	doc, ok := m.docs[id]
+	if !ok {
+		return nil, manticore.ErrDocumentNotFound
+	}
+	// 模擬 Manticore 以 32 位元儲存 float，並以 JSON 數字回傳
+	source := map[string]interface{}{}
+	for key, value := range doc {
+		switch v := value.(type) {
+		case float64:
+			source[key] = float64(float32(v))
+		case int64:
+			source[key] = float64(v)
+		default:
+			source[key] = v
+		}
+	}
+	return source, nil
+}
+
+func (m *memoryManticore) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	m.docs[id] = data
+	return nil
+}
+
+func (m *memoryManticore) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	for key, value := range data {
+		m.docs[id][key] = value
+	}
+	return nil
+}
+
+func (m *memoryManticore) Delete(ctx context.Context, index string, id int64) error {
+	delete(m.docs, id)
+	return nil
+}
+
+func (m *memoryManticore) Search(ctx context.Context, searchRequest *Manticoresearch.SearchRequest) (*Manticoresearch.SearchResponse, error) {
+	m.searches++
+	m.lastSearch = searchRequest
+	hits := []map[string]interface{}{}
+	for id := range m.docs {
+		source, _ := m.Read(ctx, searchRequest.Table, id)
+		hits = append(hits, map[string]interface{}{"_id": float64(id), "_source": source})
+	}
+	total := int32(len(hits))
+	return &Manticoresearch.SearchResponse{Hits: &Manticoresearch.SearchResponseHits{Total: &total, Hits: hits}}, nil
+}
+
+func (m *memoryManticore) Suggest(ctx context.Context, index string, word string, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (m *memoryManticore) Health(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// handleTestError 以 ApiError 的狀態碼回應，其他錯誤回應 500
+func handleTestError(c *gin.Context, err error) {
+	if apiErr, ok := err.(apiErr.ApiError); ok {
+		c.JSON(apiErr.GetStatus(), gin.H{
+			"error": apiErr.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// serveIdea 將請求送往註冊了 idea 所有路由的 gin engine，header 為請求標頭
+func serveIdea(m *idea, method string, path string, body interface{}, header map[string]string) *httptest.ResponseRecorder {
+	engine := gin.New()
+	for _, handler := range m.GetHandlers() {
+		engine.Handle(handler.Method, handler.Path, handler.Handler)
+	}
+	requestData := bytes.NewBuffer([]byte{})
+	if body != nil {
+		data, _ := json.Marshal(body)
+		requestData = bytes.NewBuffer(data)
+	}
+	req, _ := http.NewRequest(method, path, requestData)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func validUpdate(id int) *request.UpdateIdea {
+	return &request.UpdateIdea{
+		BaseIdea: request.BaseIdea{
+			MongoId:            id,
+			ItineraryName:      "森林步道",
+			AttractionName:     "太平山",
+			Tags:               []string{"新手", "一日遊"},
+			WildMode:           "露營",
+			AttractionLocation: "宜蘭, 台灣",
+			HostMessage:        "歡迎參加",
+			ExperienceDuration: 4.1,
+		},
+	}
+}
+
+func TestGetIdeaConditional(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	// PUT 回傳的 ETag 與之後 GET 的 ETag 相同
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.NotEmpty(t, w.Header().Get("Last-Modified"))
+
+	w = serveIdea(m, "GET", "/idea/1", nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = serveIdea(m, "GET", "/idea/1", nil, map[string]string{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serveIdea(m, "GET", "/idea/1", nil, map[string]string{"If-Modified-Since": time.Unix(0, 0).UTC().Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveIdea(m, "GET", "/idea/2", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+
+	// 路徑與 mongo_id 不符
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(2), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 不相符的 ETag 不會更新，並回傳目前的 ETag
+	update := validUpdate(1)
+	update.ItineraryName = "山林步道"
+	w = serveIdea(m, "PUT", "/idea/1", update, map[string]string{"If-Match": `"stale"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "森林步道", client.docs[1]["name"])
+
+	// 背景彙總的熱門度不改變 ETag
+	client.docs[1]["view_count"] = int64(42)
+	w = serveIdea(m, "PUT", "/idea/1", update, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "山林步道", client.docs[1]["name"])
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// 使用舊的 ETag 刪除失敗
+	w = serveIdea(m, "DELETE", "/idea/1", nil, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Len(t, client.docs, 1)
+
+	w = serveIdea(m, "DELETE", "/idea/1", nil, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NotZero(t, client.docs[1]["deleted_at"])
+
+	// 不存在或已刪除的 idea 不符合任何 If-Match
+	w = serveIdea(m, "DELETE", "/idea/1", nil, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// If-Match 比對後、寫入前被其他請求修改時，不會覆蓋或刪除修改後的 idea
+	racing := &racingManticore{memoryManticore: newMemoryManticore()}
+	m = newIdea(racing, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag = w.Header().Get("ETag")
+	racing.race(func() {
+		racing.docs[1]["name"] = "其他編輯"
+		racing.docs[1]["version"] = int64(2)
+	})
+	w = serveIdea(m, "PUT", "/idea/1", update, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+	assert.Equal(t, "其他編輯", racing.docs[1]["name"])
+
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	etag = w.Header().Get("ETag")
+	racing.race(func() { racing.docs[1]["version"] = int64(3) })
+	w = serveIdea(m, "DELETE", "/idea/1", nil, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Zero(t, racing.docs[1]["deleted_at"])
+}
+
+// racingManticore 在下一次讀取後執行 write，模擬在讀取與寫入之間完成的其他請求
+type racingManticore struct {
+	*memoryManticore
+	write func()
+}
+
+// race 在下一次讀取後執行 write
+func (m *racingManticore) race(write func()) {
+	m.write = write
+}
+
+func (m *racingManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	source, err := m.memoryManticore.Read(ctx, index, id)
+	if write := m.write; write != nil {
+		m.write = nil
+		write()
+	}
+	return source, err
+}
+
+func TestSearchNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	analytics := service.NewSearchAnalytics()
+	m := newIdea(client, securedAPI{}, service.WithIndexVersion(service.NewLocalIndexVersion()), service.WithSearchRecorder(analytics)).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveIdea(m, "GET", "/idea?query=rewilding_mode%3D露營", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`))
+	assert.Equal(t, 1, client.searches)
+
+	// 相同的查詢不執行搜尋，但仍計入搜尋統計
+	w = serveIdea(m, "GET", "/idea?query=rewilding_mode%3D露營", nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 1, client.searches)
+	stats := analytics.Stats(time.Hour, 0)
+	assert.Equal(t, 2, stats.Searches)
+	assert.Empty(t, stats.ZeroResultQueries)
+
+	// 不同的查詢有不同的 ETag
+	w = serveIdea(m, "GET", "/idea?query=rewilding_mode%3D野營", nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 寫入後 ETag 改變
+	w = serveIdea(m, "DELETE", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serveIdea(m, "GET", "/idea?query=rewilding_mode%3D露營", nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestVersionConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(versionHeader))
+
+	update := validUpdate(1)
+	update.Version = 1
+	w = serveIdea(m, "PUT", "/idea/1", update, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+
+	// 以舊版本儲存時回傳 409 與目前的版本
+	w = serveIdea(m, "PUT", "/idea/1", update, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+	var response struct {
+		Version int64 `json:"version"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(2), response.Version)
+
+	w = serveIdea(m, "DELETE", "/idea/1?version=1", nil, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serveIdea(m, "DELETE", "/idea/1?version=abc", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveIdea(m, "DELETE", "/idea/1?version=2", nil, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// 不存在或已刪除的 idea 帶版本刪除時回傳 404
+	w = serveIdea(m, "DELETE", "/idea/1?version=3", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveIdea(m, "DELETE", "/idea/2?version=1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveIdea(m, "DELETE", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// 資源回收筒中的 idea 無法讀取或更新
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serveIdea(m, "GET", "/idea/trash?page_size=10", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	// 一般使用者只列出自己的 idea
+	w = serveIdea(m, "GET", "/idea/trash?page_size=10", nil, map[string]string{userIDHeader: "host-1", rolesHeader: "host"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	must := client.lastSearch.Query.Bool.Must
+	assert.Len(t, must, 2)
+	assert.Equal(t, map[string]interface{}{"owner_id": "host-1"}, must[1].Equals)
+	// moderator 與 admin 列出所有使用者的 idea
+	w = serveIdea(m, "GET", "/idea/trash?page_size=10", nil, map[string]string{userIDHeader: "moderator-1", rolesHeader: authz.RoleModerator})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, client.lastSearch.Query.Bool.Must, 1)
+	var trash struct {
+		Data []struct {
+			ID        uint64 `json:"id"`
+			DeletedAt int64  `json:"deleted_at"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Len(t, trash.Data, 1)
+	assert.NotZero(t, trash.Data[0].DeletedAt)
+	w = serveIdea(m, "GET", "/idea/trash?page=abc", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveIdea(m, "POST", "/idea/1/restore", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get(versionHeader))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveIdea(m, "POST", "/idea/2/restore", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTransitionIdea(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, model.StatusDraft, client.docs[1]["status"])
+
+	// 草稿不能直接發布
+	w = serveIdea(m, "POST", "/idea/1/status", request.TransitionIdea{Status: model.StatusPublished}, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serveIdea(m, "POST", "/idea/1/status", request.TransitionIdea{Status: "deleted"}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveIdea(m, "POST", "/idea/1/status", request.TransitionIdea{}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveIdea(m, "POST", "/idea/1/status", request.TransitionIdea{Status: model.StatusPendingReview, Version: 1}, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+	var response struct {
+		Status string `json:"status"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, model.StatusPendingReview, response.Status)
+
+	w = serveIdea(m, "POST", "/idea/1/status", request.TransitionIdea{Status: model.StatusPublished, Version: 1}, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "2", w.Header().Get(versionHeader))
+	w = serveIdea(m, "POST", "/idea/2/status", request.TransitionIdea{Status: model.StatusPendingReview}, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminSearchIdeas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newIdea(newMemoryManticore(), securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+	admin := map[string]string{userIDHeader: "admin-1", rolesHeader: authz.RoleAdmin}
+
+	w := serveIdea(m, "GET", "/admin/idea", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	// 未設定 policy 時只允許 moderator 與 admin
+	w = serveIdea(m, "GET", "/admin/idea", nil, map[string]string{userIDHeader: "host-1", rolesHeader: "host"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveIdea(m, "GET", "/admin/idea", nil, map[string]string{userIDHeader: "moderator-1", rolesHeader: authz.RoleModerator})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveIdea(m, "GET", "/admin/idea?status=deleted", nil, admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveIdea(m, "GET", "/admin/idea?status=draft,pending_review", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveIdea(m, "GET", "/admin/idea?limit=abc", nil, admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestScheduledIdea(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newIdea(newMemoryManticore(), securedAPI{}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	update := validUpdate(1)
+	update.Tags = []string{"期間限定"}
+	update.PublishAt = 1_700_000_000
+	update.ExpireAt = update.PublishAt
+	w := serveIdea(m, "PUT", "/idea/1", update, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	update.ExpireAt = update.PublishAt + 86400
+	w = serveIdea(m, "PUT", "/idea/1", update, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		PublishAt int64 `json:"publish_at"`
+		ExpireAt  int64 `json:"expire_at"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, update.PublishAt, response.PublishAt)
+	assert.Equal(t, update.ExpireAt, response.ExpireAt)
+}
+
+// hs256Token 以 secret 簽署 claims，回傳 HS256 的 JWT
+func hs256Token(t *testing.T, secret string, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		assert.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": auth.HS256, "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticatedRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier, err := auth.NewVerifier(auth.Config{Algorithm: auth.HS256, Secret: "secret", Issuer: "post-test", Audience: "post"})
+	assert.NoError(t, err)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{verifier: verifier}).(*idea)
+	m.SetErrorHandler(handleTestError)
+
+	claims := map[string]interface{}{
+		"sub": "host-1",
+		"iss": "post-test",
+		"aud": "post",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	bearer := map[string]string{"Authorization": "Bearer " + hs256Token(t, "secret", claims)}
+
+	// 寫入路由需要驗證
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Empty(t, client.docs)
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), map[string]string{"Authorization": "Bearer " + hs256Token(t, "other", claims)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+
+	// 沒有 sub 的 token 無法識別使用者
+	anonymous := map[string]interface{}{"iss": "post-test", "aud": "post", "exp": claims["exp"]}
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), map[string]string{"Authorization": "Bearer " + hs256Token(t, "secret", anonymous), userIDHeader: "host-2"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, client.docs)
+
+	// 擁有者為 token 的 sub，不採用可偽造的標頭
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), map[string]string{"Authorization": bearer["Authorization"], userIDHeader: "host-2"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "host-1", client.docs[1]["owner_id"])
+
+	// 讀取路由為公開
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 管理者搜尋以 token 的 sub 作為使用者，不採用可偽造的標頭
+	w = serveIdea(m, "GET", "/admin/idea", nil, map[string]string{userIDHeader: "admin-1"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serveIdea(m, "GET", "/admin/idea", nil, map[string]string{"Authorization": bearer["Authorization"], rolesHeader: authz.RoleAdmin})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	admin := map[string]interface{}{"sub": "admin-1", "iss": "post-test", "aud": "post", "exp": claims["exp"], "roles": []string{authz.RoleAdmin}}
+	w = serveIdea(m, "GET", "/admin/idea", nil, map[string]string{"Authorization": "Bearer " + hs256Token(t, "secret", admin)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 驗證通過的 claims 存入 gin context
+	var subject string
+	handler := m.authenticated(func(c *gin.Context) {
+		if claims, ok := claimsFrom(c); ok {
+			subject = claims.Subject
+		}
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Authorization", bearer["Authorization"])
+	handler(c)
+	assert.Equal(t, "host-1", subject)
+
+	// 啟用驗證時角色只從 token 讀取
+	policy, err := authz.NewPolicy(nil)
+	assert.NoError(t, err)
+	secured := securedAPI{verifier: verifier, policy: policy}
+	claims["roles"] = []string{"host"}
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+hs256Token(t, "secret", claims))
+	c.Request.Header.Set(rolesHeader, "admin")
+	c.Request.Header.Set(userIDHeader, "admin-1")
+	secured.authenticated(func(c *gin.Context) {
+		assert.Equal(t, authz.Principal{ID: "host-1", Roles: []string{"host"}}, secured.principal(c))
+	})(c)
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set(rolesHeader, "admin")
+	c.Request.Header.Set(userIDHeader, "admin-1")
+	assert.Equal(t, authz.Principal{}, secured.principal(c))
+}
+
+// profileFunc 以函式實作 service.ProfileProvider
+type profileFunc func(userID string) (*service.UserProfile, error)
+
+func (f profileFunc) Profile(userID string) (*service.UserProfile, error) {
+	return f(userID)
+}
+
+func TestSearchIdentifiesUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier, err := auth.NewVerifier(auth.Config{Algorithm: auth.HS256, Secret: "secret"})
+	assert.NoError(t, err)
+	var users []string
+	profiles := profileFunc(func(userID string) (*service.UserProfile, error) {
+		users = append(users, userID)
+		return &service.UserProfile{PreferTags: []string{"新手"}}, nil
+	})
+	m := newIdea(newMemoryManticore(), securedAPI{verifier: verifier}, service.WithProfileProvider(profiles)).(*idea)
+	m.SetErrorHandler(handleTestError)
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// 公開的搜尋以有效 token 的 sub 取得個人化偏好
+	w := serveIdea(m, "GET", "/idea", nil, map[string]string{"Authorization": "Bearer " + hs256Token(t, "secret", claims)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"user-1"}, users)
+
+	// 沒有 token、token 無效或只有可偽造的標頭時以匿名搜尋，不回傳 401
+	for _, header := range []map[string]string{
+		nil,
+		{"Authorization": "Bearer " + hs256Token(t, "forged", claims)},
+		{userIDHeader: "user-2"},
+	} {
+		w = serveIdea(m, "GET", "/idea", nil, header)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, []string{"user-1"}, users)
+}
+
+func TestSearchEventsDedupe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier, err := auth.NewVerifier(auth.Config{Algorithm: auth.HS256, Secret: "secret"})
+	assert.NoError(t, err)
+	store, err := eventlog.NewStore(filepath.Join(t.TempDir(), "events.log"), 100, time.Hour)
+	assert.NoError(t, err)
+	m := newSearch(service.NewEventService(nil, store), nil, securedAPI{verifier: verifier}, nil).(*search)
+	m.SetErrorHandler(handleTestError)
+	engine := gin.New()
+	for _, handler := range m.GetHandlers() {
+		engine.Handle(handler.Method, handler.Path, handler.Handler)
+	}
+	token := hs256Token(t, "secret", map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()})
+	post := func(header map[string]string) int {
+		data, _ := json.Marshal(&request.SearchEvents{Events: []request.SearchEvent{{Type: "click", IdeaID: 1, Position: 1}}})
+		req, _ := http.NewRequest("POST", "/search/events", bytes.NewBuffer(data))
+		req.RemoteAddr = "192.0.2.1:1234"
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		var response struct {
+			Accepted int `json:"accepted"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Accepted
+	}
+
+	assert.Equal(t, 1, post(nil))
+	// 重送或偽造 X-Forwarded-For、X-User-Id 不會被重複計算
+	assert.Equal(t, 0, post(nil))
+	assert.Equal(t, 0, post(map[string]string{"X-Forwarded-For": "198.51.100.7"}))
+	assert.Equal(t, 0, post(map[string]string{userIDHeader: "user-2"}))
+	// 驗證過的使用者各自計算
+	assert.Equal(t, 1, post(map[string]string{"Authorization": "Bearer " + token}))
+	assert.Equal(t, 0, post(map[string]string{"Authorization": "Bearer " + token}))
+}
+
+func TestAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy, err := authz.NewPolicy(map[string]map[string]string{
+		"host":  {authz.ActionCreate: authz.ScopeOwn, authz.ActionUpdate: authz.ScopeOwn, authz.ActionDelete: authz.ScopeOwn, authz.ActionRestore: authz.ScopeOwn},
+		"admin": {authz.ActionCreate: authz.ScopeAny, authz.ActionUpdate: authz.ScopeAny, authz.ActionDelete: authz.ScopeAny, authz.ActionRestore: authz.ScopeAny},
+		"guide": {authz.ActionCreate: authz.ScopeOwn},
+	})
+	assert.NoError(t, err)
+	client := newMemoryManticore()
+	m := newIdea(client, securedAPI{policy: policy}).(*idea)
+	m.SetErrorHandler(handleTestError)
+	host := func(id string) map[string]string {
+		return map[string]string{userIDHeader: id, rolesHeader: "host"}
+	}
+
+	// 新增時以目前的使用者作為擁有者，擁有者不包含在回應中
+	w := serveIdea(m, "PUT", "/idea/1", validUpdate(1), host("host-1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "host-1", client.docs[1]["owner_id"])
+	assert.NotContains(t, w.Body.String(), "owner_id")
+	w = serveIdea(m, "GET", "/idea/1", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "host-1")
+	w = serveIdea(m, "GET", "/idea?fields=owner_id", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// host 只能編輯自己的 idea
+	w = serveIdea(m, "PUT", "/idea/1", validUpdate(1), host("host-2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "role host may only update own ideas")
+	w = serveIdea(m, "DELETE", "/idea/1", nil, host("host-2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	update := validUpdate(1)
+	update.Version = 1
+	w = serveIdea(m, "PUT", "/idea/1", update, host("host-1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 沒有角色或身分時拒絕
+	w = serveIdea(m, "PUT", "/idea/2", validUpdate(2), map[string]string{userIDHeader: "guest"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveIdea(m, "PUT", "/idea/2", validUpdate(2), map[string]string{rolesHeader: "host"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "missing user identity")
+
+	// admin 可以編輯任何 idea，且不會改變擁有者
+	update.Version = 2
+	w = serveIdea(m, "PUT", "/idea/1", update, map[string]string{userIDHeader: "admin-1", rolesHeader: "host, admin"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "host-1", client.docs[1]["owner_id"])
+	w = serveIdea(m, "DELETE", "/idea/1", nil, map[string]string{userIDHeader: "admin-1", rolesHeader: "admin"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// 只有允許 restore 的角色可以還原資源回收筒中的 idea，host 只能還原自己的 idea
+	w = serveIdea(m, "POST", "/idea/1/restore", nil, map[string]string{userIDHeader: "host-1", rolesHeader: "guide"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "no role of [guide] permits restore")
+	w = serveIdea(m, "POST", "/idea/1/restore", nil, host("host-2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "role host may only restore own ideas")
+	assert.NotZero(t, client.docs[1]["deleted_at"])
+	w = serveIdea(m, "POST", "/idea/1/restore", nil, host("host-1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 0, client.docs[1]["deleted_at"])
+	w = serveIdea(m, "DELETE", "/idea/1", nil, host("host-1"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serveIdea(m, "POST", "/idea/1/restore", nil, map[string]string{userIDHeader: "admin-1", rolesHeader: "admin"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 0, client.docs[1]["deleted_at"])
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter, err := ratelimit.NewLimiter(ratelimit.NewMemory(), map[string]ratelimit.Limit{
+		ratelimit.BudgetSearch: {Requests: 1, Period: time.Minute, Burst: 2},
+		ratelimit.BudgetWrite:  {Requests: 1, Period: time.Minute},
+	})
+	assert.NoError(t, err)
+	middle := newRateLimitMiddle(limiter, nil, []string{"key-1"}, nil)
+	middle.SetErrorHandler(handleTestError)
+	engine := gin.New()
+	engine.Use(middle.Handler())
+	for _, path := range []string{"/idea", "/idea/:id", "/keyword/autocomplete", "/admin/idea"} {
+		engine.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+	engine.DELETE("/idea/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	engine.POST("/search/events", func(c *gin.Context) { c.Status(http.StatusAccepted) })
+	serve := func(method string, path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	// search 的額度由 GET /idea 與 GET /idea/:id 共用
+	w := serve("GET", "/idea", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	w = serve("GET", "/idea/1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	w = serve("GET", "/idea", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "rate limit exceeded for search")
+	// 管理用的搜尋也使用 search 的額度
+	w = serve("GET", "/admin/idea", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// 未設定 trusted proxy 時，更換 X-Forwarded-For 不會取得新的 bucket
+	for i := 0; i < 3; i++ {
+		w = serve("GET", "/idea", map[string]string{"X-Forwarded-For": fmt.Sprintf("203.0.113.%d", i)})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	}
+
+	// 每個 budget 與 client 各自計算
+	w = serve("DELETE", "/idea/1", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	// 搜尋事件與 idea 的寫入共用 write 的額度
+	w = serve("POST", "/search/events", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	w = serve("GET", "/idea", map[string]string{apiKeyHeader: "key-1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 更換未驗證的標頭不會取得新的 bucket
+	for i := 0; i < 3; i++ {
+		w = serve("GET", "/idea", map[string]string{
+			userIDHeader: fmt.Sprintf("user-%d", i),
+			apiKeyHeader: fmt.Sprintf("random-%d", i),
+		})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	}
+
+	// 啟用驗證時以有效 token 的 sub 計算額度
+	verifier, err := auth.NewVerifier(auth.Config{Algorithm: auth.HS256, Secret: "secret"})
+	assert.NoError(t, err)
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/idea", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("Authorization", "Bearer "+hs256Token(t, "secret", claims))
+	assert.Equal(t, "user:user-1", newRateLimitMiddle(limiter, verifier, nil, nil).clientKey(c))
+	c.Request.Header.Set("Authorization", "Bearer "+hs256Token(t, "forged", claims))
+	assert.Equal(t, "ip:10.0.0.1", newRateLimitMiddle(limiter, verifier, nil, nil).clientKey(c))
+
+	// 連線來自 trusted proxy 時，取 X-Forwarded-For 中最右邊不是 trusted proxy 的位址
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	behindProxy := newRateLimitMiddle(limiter, nil, nil, []*net.IPNet{proxies})
+	c.Request.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.2")
+	assert.Equal(t, "ip:203.0.113.7", behindProxy.clientKey(c))
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "ip:192.0.2.1", behindProxy.clientKey(c))
+
+	// 未設定 budget 的 autocomplete 不限制
+	w = serve("GET", "/keyword/autocomplete", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/94peter/microservice/apitool"
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/authz"
+	"github.com/arwoosa/post/router/request"
+	"github.com/arwoosa/post/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultStatsWindow 未指定 window 時統計的期間
+	defaultStatsWindow = 24 * time.Hour
+	// maxStatsLimit 統計報表排行榜筆數的上限
+	maxStatsLimit = 100
+)
+
+var (
+	// errEventsDisabled 未設定事件紀錄時回報搜尋事件
+	errEventsDisabled = errors.New("search event tracking is disabled")
+	// errAnalyticsDisabled 未設定搜尋紀錄時查詢統計
+	errAnalyticsDisabled = errors.New("search analytics is disabled")
+)
+
+type search struct {
+	securedAPI
+	events    *service.EventService
+	analytics *service.SearchAnalytics
+	// trustedProxies 以 IP 識別回報事件的 client 時，可信任其 X-Forwarded-For 的 proxy
+	trustedProxies []*net.IPNet
+}
+
+func newSearch(events *service.EventService, analytics *service.SearchAnalytics, secured securedAPI, trustedProxies []*net.IPNet) apitool.GinAPI {
+	return &search{securedAPI: secured, events: events, analytics: analytics, trustedProxies: trustedProxies}
+}
+
+func (m *search) GetHandlers() []*apitool.GinHandler {
+	return []*apitool.GinHandler{
+		{
+			Path:    "/search/events",
+			Method:  "POST",
+			Handler: m.identified(m.recordEvents),
+		},
+		{
+			Path:    "/admin/search/stats",
+			Method:  "GET",
+			Handler: m.authenticated(m.getStats),
+		},
+	}
+}
+
+func (m *search) recordEvents(c *gin.Context) {
+	if m.events == nil {
+		m.GinErrorWithStatusHandler(c, http.StatusServiceUnavailable, errEventsDisabled)
+		return
+	}
+	var requestBody request.SearchEvents
+	if err := c.BindJSON(&requestBody); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := requestBody.Validate(); err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+
+	events := make([]model.SearchEvent, 0, len(requestBody.Events))
+	for _, event := range requestBody.Events {
+		events = append(events, model.SearchEvent{
+			Type:     model.SearchEventType(event.Type),
+			Query:    event.Query,
+			IdeaID:   event.IdeaID,
+			Position: event.Position,
+		})
+	}
+	accepted, err := m.events.RecordEvents(m.eventClient(c), events)
+	if err != nil {
+		m.GinErrorHandler(c, serviceError(err))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"accepted": accepted,
+	})
+}
+
+// eventClient 回傳去重搜尋事件時識別 client 的 key，帶有效 token 時為使用者，否則為 IP；
+// 不採用 X-User-Id 等客戶端可任意變更的標頭
+func (m *search) eventClient(c *gin.Context) string {
+	if claims, ok := claimsFrom(c); ok {
+		return "user:" + claims.Subject
+	}
+	return "ip:" + clientIP(c, m.trustedProxies)
+}
+
+// getStats 回傳最近 window 期間的搜尋統計，limit 為排行榜的筆數；
+// 需要 policy 允許 view_stats 的角色，未設定 policy 時為 moderator 或 admin
+func (m *search) getStats(c *gin.Context) {
+	if !m.authorizeAdmin(c, authz.ActionViewStats) {
+		return
+	}
+	if m.analytics == nil {
+		m.GinErrorWithStatusHandler(c, http.StatusServiceUnavailable, errAnalyticsDisabled)
+		return
+	}
+	window := defaultStatsWindow
+	if value := c.Query("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid window: %s", value))
+			return
+		}
+		window = parsed
+	}
+	limit, err := queryInt32(c, "limit")
+	if err != nil {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, err)
+		return
+	}
+	if limit < 0 || limit > maxStatsLimit {
+		m.GinErrorWithStatusHandler(c, http.StatusBadRequest, fmt.Errorf("invalid limit: must be between 1 and %d", maxStatsLimit))
+		return
+	}
+
+	c.JSON(http.StatusOK, m.analytics.Stats(window, int(limit)))
+}
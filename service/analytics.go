@@ -0,0 +1,219 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/spf13/viper"
+)
+
+const (
+	// defaultAnalyticsCapacity 未設定 analytics.capacity 時保留的搜尋紀錄筆數
+	defaultAnalyticsCapacity = 10000
+	// defaultStatsLimit 統計報表中每個排行榜的預設筆數
+	defaultStatsLimit = 10
+)
+
+// SearchRecord 一次搜尋的紀錄
+type SearchRecord struct {
+	// Query 正規化後的關鍵字或語意搜尋文字
+	Query string
+	// Filters 關鍵字以外的過濾條件，以 query string 編碼且依名稱排序
+	Filters string
+	// Results 搜尋結果的總筆數，Corrected 為 true 時為修正後關鍵字的結果
+	Results   int64
+	Corrected bool
+	// NotModified 以 ETag 判斷客戶端的結果仍然有效而未搜尋，Results 與 Corrected 未知
+	NotModified bool
+	Latency     time.Duration
+	At          time.Time
+}
+
+// zeroResult 原始查詢是否沒有任何結果，結果未知時視為有結果
+func (r SearchRecord) zeroResult() bool {
+	return !r.NotModified && (r.Results == 0 || r.Corrected)
+}
+
+// SearchRecorder 接收 IdeaService 的搜尋紀錄
+type SearchRecorder interface {
+	RecordSearch(record SearchRecord)
+}
+
+// WithSearchRecorder 指定記錄搜尋的 SearchRecorder，未指定時不記錄
+func WithSearchRecorder(recorder SearchRecorder) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.recorder = recorder
+	}
+}
+
+// newSearchRecord 由搜尋參數與結果建立紀錄，關鍵字轉為小寫並合併連續空白；response 為 nil 表示結果未變更
+func newSearchRecord(params SearchParams, response *model.SearchResponse, at time.Time, latency time.Duration) SearchRecord {
+	filters := decodeQuery(params.Query)
+	query, _ := filters["keyword"].(string)
+	delete(filters, "keyword")
+	if params.Semantic != "" {
+		query = params.Semantic
+	}
+	record := SearchRecord{
+		Query:       strings.Join(strings.Fields(strings.ToLower(query)), " "),
+		Filters:     encodeQuery(filters),
+		NotModified: response == nil,
+		Latency:     latency,
+		At:          at,
+	}
+	if response != nil {
+		record.Results = response.Total
+		record.Corrected = response.Corrected
+	}
+	return record
+}
+
+// QueryCount 查詢條件與其搜尋次數
+type QueryCount struct {
+	Query   string `json:"query"`
+	Filters string `json:"filters,omitempty"`
+	Count   int    `json:"count"`
+}
+
+// SearchStats 一段期間內的搜尋統計
+type SearchStats struct {
+	// Window 統計實際涵蓋的期間，即 From 到 To；紀錄超過容量而被覆蓋時短於要求的期間
+	Window string    `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Truncated 要求的期間內有紀錄已被覆蓋，Searches 等統計只涵蓋 Window
+	Truncated bool `json:"truncated"`
+	Searches  int  `json:"searches"`
+	// TopQueries 搜尋次數最多的查詢，不含沒有任何條件的瀏覽
+	TopQueries []QueryCount `json:"top_queries"`
+	// ZeroResultQueries 沒有結果 (或需要自動修正關鍵字) 次數最多的查詢
+	ZeroResultQueries []QueryCount `json:"zero_result_queries"`
+	LatencyP50Ms      float64      `json:"latency_p50_ms"`
+	LatencyP95Ms      float64      `json:"latency_p95_ms"`
+}
+
+// SearchAnalytics 在記憶體中保留最近的搜尋紀錄，超過容量時覆蓋最舊的紀錄
+type SearchAnalytics struct {
+	mu      sync.Mutex
+	records []SearchRecord
+	// next 下一筆紀錄寫入的位置
+	next int
+	full bool
+	now  func() time.Time
+}
+
+// NewSearchAnalytics 創建 SearchAnalytics，容量讀取 analytics.capacity
+func NewSearchAnalytics() *SearchAnalytics {
+	capacity := viper.GetInt("analytics.capacity")
+	if capacity <= 0 {
+		capacity = defaultAnalyticsCapacity
+	}
+	return &SearchAnalytics{
+		records: make([]SearchRecord, capacity),
+		now:     time.Now,
+	}
+}
+
+// RecordSearch 實作 SearchRecorder
+func (a *SearchAnalytics) RecordSearch(record SearchRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records[a.next] = record
+	a.next = (a.next + 1) % len(a.records)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// Stats 統計最近 window 期間的搜尋，排行榜各取前 limit 筆，limit 為 0 時使用預設值。
+// 最舊的紀錄晚於 window 的起點且較早的紀錄已被覆蓋時，只統計最舊的紀錄之後的期間，並標示為 Truncated
+func (a *SearchAnalytics) Stats(window time.Duration, limit int) SearchStats {
+	if limit <= 0 {
+		limit = defaultStatsLimit
+	}
+	now := a.now()
+	since := now.Add(-window)
+
+	a.mu.Lock()
+	records := make([]SearchRecord, 0, len(a.records))
+	size := a.next
+	truncated := false
+	if a.full {
+		size = len(a.records)
+		if oldest := a.records[a.next].At; oldest.After(since) {
+			since = oldest
+			truncated = true
+		}
+	}
+	for _, record := range a.records[:size] {
+		if !record.At.Before(since) {
+			records = append(records, record)
+		}
+	}
+	a.mu.Unlock()
+
+	top := make(map[QueryCount]int)
+	zero := make(map[QueryCount]int)
+	latencies := make([]time.Duration, 0, len(records))
+	for _, record := range records {
+		latencies = append(latencies, record.Latency)
+		if record.Query == "" && record.Filters == "" {
+			continue
+		}
+		key := QueryCount{Query: record.Query, Filters: record.Filters}
+		top[key]++
+		if record.zeroResult() {
+			zero[key]++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	return SearchStats{
+		Window:            now.Sub(since).String(),
+		From:              since,
+		To:                now,
+		Truncated:         truncated,
+		Searches:          len(records),
+		TopQueries:        rankQueries(top, limit),
+		ZeroResultQueries: rankQueries(zero, limit),
+		LatencyP50Ms:      percentile(latencies, 50),
+		LatencyP95Ms:      percentile(latencies, 95),
+	}
+}
+
+// rankQueries 依次數由多到少排列，次數相同時依查詢條件排列
+func rankQueries(counts map[QueryCount]int, limit int) []QueryCount {
+	ranked := make([]QueryCount, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		ranked = append(ranked, key)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		if ranked[i].Query != ranked[j].Query {
+			return ranked[i].Query < ranked[j].Query
+		}
+		return ranked[i].Filters < ranked[j].Filters
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// percentile 以 nearest-rank 計算已排序延遲的百分位數，單位為毫秒
+func percentile(sorted []time.Duration, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1]) / float64(time.Millisecond)
+}
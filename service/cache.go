@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/cache"
+	"github.com/arwoosa/post/pkg/logging"
+)
+
+// defaultCacheTTL 未設定 cache.ttl 時搜尋結果的保存時間
+const defaultCacheTTL = 30 * time.Second
+
+// SearchCache 快取 SearchIdeas 的結果，IdeaService 寫入 idea 時清除。
+// 搜尋結果以 gob 編碼，保留 JSON 不輸出的 Scroll 與 Fields。
+// ttl 應短於 pagination.cursor_ttl，避免回傳已過期的 next_cursor。
+type SearchCache struct {
+	backend cache.Backend
+	ttl     time.Duration
+}
+
+// NewSearchCache 以 backend 創建 SearchCache，ttl 不大於 0 時使用 defaultCacheTTL
+func NewSearchCache(backend cache.Backend, ttl time.Duration) *SearchCache {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &SearchCache{backend: backend, ttl: ttl}
+}
+
+// WithSearchCache 指定快取搜尋結果的 SearchCache，未指定時不快取
+func WithSearchCache(cache *SearchCache) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.cache = cache
+	}
+}
+
+// cacheable 判斷搜尋是否可以快取：續頁依賴游標的狀態，個人化搜尋因人而異，都不快取
+func cacheable(params SearchParams) bool {
+	return params.Cursor == "" && params.UserID == "" && params.Prefer == nil
+}
+
+// searchKey 以正規化後的過濾條件、排序、分頁與個人化參數產生識別搜尋的字串，
+// 過濾條件依名稱排序並去除前後空白，相同條件不同寫法會得到相同的字串
+func searchKey(params SearchParams) string {
+	filters := decodeQuery(params.Query)
+	for key, value := range filters {
+		filters[key] = strings.TrimSpace(value.(string))
+	}
+	fields := append([]string(nil), params.Fields...)
+	sort.Strings(fields)
+	prefer, _ := json.Marshal(params.Prefer)
+
+	return strings.Join([]string{
+		"q=" + encodeQuery(filters),
+		"cursor=" + params.Cursor,
+		"rank=" + params.Rank,
+		fmt.Sprintf("limit=%d", params.Limit),
+		fmt.Sprintf("page=%d", params.Page),
+		fmt.Sprintf("page_size=%d", params.PageSize),
+		"fields=" + strings.Join(fields, ","),
+		"semantic=" + strings.TrimSpace(params.Semantic),
+		fmt.Sprintf("hybrid=%t", params.Hybrid),
+		"user_id=" + params.UserID,
+		"prefer=" + string(prefer),
+		"statuses=" + strings.Join(params.Statuses, ","),
+	}, "&")
+}
+
+// searchCacheKey 回傳搜尋結果的快取鍵
+func searchCacheKey(params SearchParams) string {
+	sum := sha256.Sum256([]byte(searchKey(params)))
+	return "search:" + hex.EncodeToString(sum[:])
+}
+
+// get 取得快取的搜尋結果，後端錯誤視為未命中
+func (c *SearchCache) get(ctx context.Context, key string) (*model.SearchResponse, bool) {
+	value, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "read search cache failed", logging.KeyError, err.Error())
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	response := &model.SearchResponse{}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(response); err != nil {
+		slog.WarnContext(ctx, "decode search cache failed", logging.KeyError, err.Error())
+		return nil, false
+	}
+	return response, true
+}
+
+// set 儲存搜尋結果，失敗時只記錄警告
+func (c *SearchCache) set(ctx context.Context, key string, response *model.SearchResponse) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(response); err != nil {
+		slog.WarnContext(ctx, "encode search cache failed", logging.KeyError, err.Error())
+		return
+	}
+	if err := c.backend.Set(ctx, key, buf.Bytes(), c.ttl); err != nil {
+		slog.WarnContext(ctx, "write search cache failed", logging.KeyError, err.Error())
+	}
+}
+
+// Invalidate 清除所有快取的搜尋結果
+func (c *SearchCache) Invalidate(ctx context.Context) {
+	if err := c.backend.Clear(ctx); err != nil {
+		slog.WarnContext(ctx, "clear search cache failed", logging.KeyError, err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultCursorTTL 未設定 pagination.cursor_ttl 時游標的有效期間
+const defaultCursorTTL = time.Hour
+
+var (
+	fallbackSecret     []byte
+	fallbackSecretOnce sync.Once
+)
+
+// cursor 是分頁游標的內容。
+// 游標以 base64url(JSON) + "." + base64url(HMAC-SHA256) 編碼，對客戶端而言是不透明的字串，
+// 客戶端只能原封不動地帶回 next_cursor，任何修改都會讓簽章驗證失敗。
+type cursor struct {
+	// Query 產生游標時的查詢字串
+	Query string `json:"q"`
+	// Prefer 產生游標時的個人化偏好
+	Prefer *UserProfile `json:"u,omitempty"`
+	// Rank 產生游標時的排序方式名稱
+	Rank string `json:"r,omitempty"`
+	// Statuses 產生游標時搜尋的狀態，為空表示公開搜尋
+	Statuses []string `json:"t,omitempty"`
+	// Sort 產生游標時的排序，續頁時沿用，避免預設排序變更後游標失效
+	Sort []map[string]string `json:"o"`
+	// Scroll Manticore 回傳的 scroll token
+	Scroll string `json:"s"`
+	// Position 已回傳給客戶端的筆數
+	Position int64 `json:"p"`
+	// ExpiresAt 游標過期的 Unix 時間
+	ExpiresAt int64 `json:"e"`
+}
+
+// cursorCodec 負責游標的簽章與驗證
+type cursorCodec struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// newCursorCodec 依 pagination 設定創建 cursorCodec。
+// 未設定 pagination.cursor_secret 時使用程序啟動後隨機產生的金鑰，重新啟動後舊游標即失效。
+func newCursorCodec() *cursorCodec {
+	secret := []byte(viper.GetString("pagination.cursor_secret"))
+	if len(secret) == 0 {
+		fallbackSecretOnce.Do(func() {
+			fallbackSecret = make([]byte, 32)
+			if _, err := rand.Read(fallbackSecret); err != nil {
+				panic(fmt.Errorf("產生游標金鑰失敗: %w", err))
+			}
+		})
+		secret = fallbackSecret
+	}
+
+	ttl := viper.GetDuration("pagination.cursor_ttl")
+	if ttl <= 0 {
+		ttl = defaultCursorTTL
+	}
+
+	return &cursorCodec{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Encode 設定游標的過期時間並簽章
+func (c *cursorCodec) Encode(cur *cursor) (string, error) {
+	cur.ExpiresAt = c.now().Add(c.ttl).Unix()
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", fmt.Errorf("編碼游標失敗: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded)), nil
+}
+
+// Decode 驗證游標的簽章與有效期間
+func (c *cursorCodec) Decode(token string) (*cursor, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(encoded)) {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cur := &cursor{}
+	if err := json.Unmarshal(payload, cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.now().Unix() >= cur.ExpiresAt {
+		return nil, ErrCursorExpired
+	}
+	return cur, nil
+}
+
+func (c *cursorCodec) sign(encoded string) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidCursor 分頁游標格式錯誤、遭竄改或與查詢條件不符
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorExpired 分頁游標已過期
+	ErrCursorExpired = errors.New("cursor expired")
+	// ErrInvalidLimit 每頁筆數超出允許範圍
+	ErrInvalidLimit = errors.New("invalid limit")
+	// ErrInvalidPage 頁碼格式錯誤或與游標同時使用
+	ErrInvalidPage = errors.New("invalid page")
+	// ErrPageOutOfRange 頁碼超出搜尋引擎的 max_matches 範圍
+	ErrPageOutOfRange = errors.New("page out of range")
+	// ErrInvalidFields fields 參數包含未知的欄位
+	ErrInvalidFields = errors.New("invalid fields")
+	// ErrInvalidRank rank 參數不是已設定的排序方式
+	ErrInvalidRank = errors.New("invalid rank")
+	// ErrInvalidEvent 搜尋事件的種類、idea_id 或位置不正確
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrInvalidStatus 不是已定義的 idea 狀態
+	ErrInvalidStatus = errors.New("invalid status")
+	// ErrInvalidTransition idea 目前的狀態不能轉換為指定的狀態
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrIdeaNotFound 指定的 idea 不存在
+	ErrIdeaNotFound = errors.New("idea not found")
+	// ErrIdeaInTrash idea 在資源回收筒中，需先還原才能更新
+	ErrIdeaInTrash = errors.New("idea is in trash")
+	// ErrVersionConflict idea 已被其他人修改，詳細的版本見 ConflictError
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// ConflictError 表示寫入時 idea 目前的版本與客戶端讀取時的版本不同
+type ConflictError struct {
+	ID int64
+	// Expected 客戶端讀取時的版本
+	Expected int64
+	// Current 目前的版本，idea 已被刪除時為 0
+	Current int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("idea %d: %s: expected version %d, current version %d", e.ID, ErrVersionConflict, e.Expected, e.Current)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/eventlog"
+	"github.com/arwoosa/post/pkg/logging"
+	"github.com/arwoosa/post/pkg/manticore"
+)
+
+// eventCounters 定義各種搜尋事件彙總到 idea 的熱門度欄位
+var eventCounters = map[model.SearchEventType]string{
+	model.SearchEventImpression: "impression_count",
+	model.SearchEventClick:      "view_count",
+	model.SearchEventBookmark:   "bookmark_count",
+}
+
+// defaultDedupeWindow 同一個 client 對同一個 idea 的同種事件只計算一次的期間
+const defaultDedupeWindow = 30 * time.Minute
+
+// EventService 記錄搜尋事件，並定期彙總為 idea 的熱門度指標
+type EventService struct {
+	client manticore.ManticoreService
+	store  *eventlog.Store
+	index  string
+	// checkpoint 記錄已彙總到事件紀錄的哪個位置
+	checkpoint string
+	// cache 不為 nil 時在彙總更新熱門度後清除，排序才會反映新的熱門度
+	cache *SearchCache
+	// version 不為 nil 時在彙總更新熱門度後遞增，搜尋結果的 ETag 才會改變
+	version IndexVersion
+	now     func() time.Time
+
+	// dedupeWindow 內同一個 client 重複回報的事件只記錄第一次；
+	// seen 只保存在行程內，多個實例時各自去重
+	dedupeWindow time.Duration
+	mu           sync.Mutex
+	seen         map[string]time.Time
+	lastPrune    time.Time
+}
+
+// EventServiceOption 設定 EventService 的選項
+type EventServiceOption func(*EventService)
+
+// WithRollupInvalidation 指定 Rollup 更新熱門度後要清除的 SearchCache 與要遞增的 IndexVersion，
+// 應與 IdeaService 使用相同的實例；任一個為 nil 時略過
+func WithRollupInvalidation(cache *SearchCache, version IndexVersion) EventServiceOption {
+	return func(s *EventService) {
+		s.cache = cache
+		s.version = version
+	}
+}
+
+// WithDedupeWindow 指定同一個 client 重複回報的事件只記錄一次的期間，未指定時為 30 分鐘
+func WithDedupeWindow(window time.Duration) EventServiceOption {
+	return func(s *EventService) {
+		s.dedupeWindow = window
+	}
+}
+
+// NewEventService 創建新的 EventService 實例
+func NewEventService(client manticore.ManticoreService, store *eventlog.Store, opts ...EventServiceOption) *EventService {
+	svc := &EventService{
+		client:       client,
+		store:        store,
+		index:        "idea",
+		checkpoint:   store.Path() + ".offset",
+		now:          time.Now,
+		dedupeWindow: defaultDedupeWindow,
+		seen:         make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+// RecordEvents 驗證並記錄 client 回報的搜尋事件，回傳實際記錄的事件數量。
+// 事件時間一律以伺服器收到的時間記錄；dedupeWindow 內同一個 client 對同一個 idea 的同種事件
+// 只記錄第一次，避免重送事件灌高熱門度。client 應為驗證過的使用者或連線位址，不可由客戶端任意指定。
+func (s *EventService) RecordEvents(client string, events []model.SearchEvent) (int, error) {
+	for _, event := range events {
+		if _, ok := eventCounters[event.Type]; !ok {
+			return 0, fmt.Errorf("%w: 未知的事件種類 %q", ErrInvalidEvent, event.Type)
+		}
+		if event.IdeaID == 0 {
+			return 0, fmt.Errorf("%w: idea_id 必須大於 0", ErrInvalidEvent)
+		}
+		if event.Position <= 0 {
+			return 0, fmt.Errorf("%w: position 必須大於 0", ErrInvalidEvent)
+		}
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	records := make([]interface{}, 0, len(events))
+	keys := make([]string, 0, len(events))
+	for i := range events {
+		event := events[i]
+		key := fmt.Sprintf("%s\n%s\n%d", client, event.Type, event.IdeaID)
+		if seen, ok := s.seen[key]; ok && now.Sub(seen) < s.dedupeWindow {
+			continue
+		}
+		s.seen[key] = now
+		keys = append(keys, key)
+		event.Query = strings.TrimSpace(event.Query)
+		event.Timestamp = now.Unix()
+		records = append(records, event)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := s.store.Append(records...); err != nil {
+		// 未記錄的事件可以重新回報
+		for _, key := range keys {
+			delete(s.seen, key)
+		}
+		return 0, fmt.Errorf("記錄搜尋事件失敗: %w", err)
+	}
+	return len(records), nil
+}
+
+// prune 每隔 dedupeWindow 移除已超過 dedupeWindow 的去重紀錄，呼叫時需持有 mu
+func (s *EventService) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.dedupeWindow {
+		return
+	}
+	for key, seen := range s.seen {
+		if now.Sub(seen) >= s.dedupeWindow {
+			delete(s.seen, key)
+		}
+	}
+	s.lastPrune = now
+}
+
+// Rollup 將上次彙總後新增的事件累加到各 idea 的熱門度欄位，並在更新後清除搜尋快取、遞增索引版本。
+// 所有 idea 更新成功後才推進 checkpoint，更新失敗時整批事件會在下次重新彙總，
+// 因此已更新的 idea 可能被重複計算。已刪除的 idea 會被略過。
+func (s *EventService) Rollup(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "EventService.Rollup")
+	defer func() { endSpan(span, err) }()
+
+	offset, err := s.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[uint64]map[string]int64)
+	next, err := s.store.ReadFrom(offset, func(line []byte) error {
+		var event model.SearchEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			// 格式錯誤的紀錄無法重新處理，直接略過
+			return nil
+		}
+		column, ok := eventCounters[event.Type]
+		if !ok || event.IdeaID == 0 {
+			return nil
+		}
+		if counts[event.IdeaID] == nil {
+			counts[event.IdeaID] = make(map[string]int64)
+		}
+		counts[event.IdeaID][column]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if next == offset {
+		return nil
+	}
+
+	ids := make([]uint64, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if len(ids) > 0 {
+		// 部分 idea 更新失敗時，已更新的熱門度仍會影響排序
+		defer invalidateSearch(ctx, s.cache, s.version)
+	}
+	for _, id := range ids {
+		if err := s.addCounts(ctx, id, counts[id]); err != nil {
+			return err
+		}
+	}
+	return s.writeCheckpoint(next)
+}
+
+// addCounts 將 counts 累加到 idea 的熱門度欄位，與 IdeaService 的寫入共用 lockIdea，
+// 避免 ReplaceIdea 以讀取時的熱門度覆蓋累加的結果；已刪除的 idea 會被略過
+func (s *EventService) addCounts(ctx context.Context, id uint64, counts map[string]int64) error {
+	unlock := lockIdea(int64(id))
+	defer unlock()
+
+	source, err := s.client.Read(ctx, s.index, int64(id))
+	if errors.Is(err, manticore.ErrDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("讀取 idea %d 失敗: %w", id, err)
+	}
+	current := model.IdeaDataFromMap(id, source).ToMap()
+	doc := make(map[string]interface{}, len(counts))
+	for column, count := range counts {
+		doc[column] = current[column].(int64) + count
+	}
+	if err := s.client.Update(ctx, s.index, int64(id), doc); err != nil {
+		return fmt.Errorf("更新 idea %d 熱門度失敗: %w", id, err)
+	}
+	return nil
+}
+
+// RunRollup 每隔 interval 執行一次 Rollup，直到 ctx 結束
+func (s *EventService) RunRollup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Manticore 的錯誤已在呼叫時記錄，此處只記錄彙總失敗
+			if err := s.Rollup(ctx); err != nil {
+				slog.WarnContext(ctx, "rollup search events failed", logging.KeyError, err.Error())
+			}
+		}
+	}
+}
+
+// readCheckpoint 讀取上次彙總的位置，尚未彙總過時為 0
+func (s *EventService) readCheckpoint() (int64, error) {
+	content, err := os.ReadFile(s.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("讀取彙總位置失敗: %w", err)
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("彙總位置格式錯誤: %w", err)
+	}
+	return offset, nil
+}
+
+// writeCheckpoint 先寫入暫存檔再改名，避免中斷時留下不完整的位置
+func (s *EventService) writeCheckpoint(offset int64) error {
+	tmp := s.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o600); err != nil {
+		return fmt.Errorf("寫入彙總位置失敗: %w", err)
+	}
+	if err := os.Rename(tmp, s.checkpoint); err != nil {
+		return fmt.Errorf("寫入彙總位置失敗: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/manticore"
+	"github.com/spf13/viper"
+)
+
+const (
+	// CheckOK 與 CheckFail 為單項檢查的結果
+	CheckOK   = "ok"
+	CheckFail = "fail"
+	// defaultCheckTimeout 未設定 health.timeout 時每項檢查的逾時
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// CheckResult 單項就緒檢查的結果
+type CheckResult struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	LatencyMs float64                `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport 就緒檢查的報告，所有檢查都通過時 Status 為 ok
+type ReadinessReport struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Ready 是否所有檢查都通過
+func (r *ReadinessReport) Ready() bool {
+	return r.Status == CheckOK
+}
+
+// HealthService 檢查 Manticore 與 idea 表是否可以提供服務
+type HealthService struct {
+	client    manticore.ManticoreService
+	inspector manticore.Inspector
+	index     string
+	columns   []model.Column
+	timeout   time.Duration
+}
+
+// NewHealthService 創建新的 HealthService，每項檢查的逾時讀取 health.timeout
+func NewHealthService(client manticore.ManticoreService, inspector manticore.Inspector) *HealthService {
+	timeout := viper.GetDuration("health.timeout")
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	return &HealthService{
+		client:    client,
+		inspector: inspector,
+		index:     "idea",
+		columns:   model.IdeaColumns,
+		timeout:   timeout,
+	}
+}
+
+// Readiness 依序檢查 Manticore 連線、idea 表結構、文件數量與叢集複寫狀態
+func (s *HealthService) Readiness(ctx context.Context) *ReadinessReport {
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) (map[string]interface{}, error)
+	}{
+		{"manticore", s.checkManticore},
+		{"schema", s.checkSchema},
+		{"documents", s.checkDocuments},
+		{"replication", s.checkReplication},
+	}
+
+	report := &ReadinessReport{Status: CheckOK, Checks: make([]CheckResult, 0, len(checks))}
+	for _, check := range checks {
+		result := s.run(ctx, check.name, check.run)
+		if result.Status != CheckOK {
+			report.Status = CheckFail
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// run 以逾時執行單項檢查並記錄延遲
+func (s *HealthService) run(ctx context.Context, name string, check func(ctx context.Context) (map[string]interface{}, error)) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := CheckResult{
+		Name:      name,
+		Status:    CheckOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = CheckFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (s *HealthService) checkManticore(ctx context.Context) (map[string]interface{}, error) {
+	ok, err := s.client.Health(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("manticore is unhealthy")
+	}
+	return nil, nil
+}
+
+// checkSchema 確認 idea 表存在，且包含 model.IdeaColumns 定義的欄位與型別
+func (s *HealthService) checkSchema(ctx context.Context) (map[string]interface{}, error) {
+	fields, err := s.inspector.Describe(ctx, s.index)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string][]string)
+	for _, field := range fields {
+		types[field.Name] = append(types[field.Name], field.Type)
+	}
+
+	var problems []string
+	for _, column := range s.columns {
+		expected := strings.Fields(column.Type)[0]
+		actual, ok := types[column.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing", column.Name))
+			continue
+		}
+		if !matchType(expected, actual) {
+			problems = append(problems, fmt.Sprintf("%s: expected %s, got %s", column.Name, expected, strings.Join(actual, "/")))
+		}
+	}
+	details := map[string]interface{}{"table": s.index, "columns": len(types)}
+	if len(problems) > 0 {
+		details["mismatches"] = problems
+		return details, fmt.Errorf("table %s does not match the expected schema", s.index)
+	}
+	return details, nil
+}
+
+// matchType 比對欄位型別，同時是全文與屬性的字串欄位在 DESCRIBE 中可能顯示為 text 或 string
+func matchType(expected string, actual []string) bool {
+	for _, typ := range actual {
+		if typ == expected || (expected == "string" && typ == "text") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *HealthService) checkDocuments(ctx context.Context) (map[string]interface{}, error) {
+	status, err := s.inspector.TableStatus(ctx, s.index)
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.ParseInt(status["indexed_documents"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid indexed_documents: %q", status["indexed_documents"])
+	}
+	return map[string]interface{}{"count": count}, nil
+}
+
+// checkReplication 回報每個叢集的狀態，未設定叢集時視為單機；任何叢集不是 primary 時失敗
+func (s *HealthService) checkReplication(ctx context.Context) (map[string]interface{}, error) {
+	status, err := s.inspector.ReplicationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]interface{})
+	var degraded []string
+	for counter, value := range status {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(counter, "cluster_"), "_status")
+		if !ok || !strings.HasPrefix(counter, "cluster_") {
+			continue
+		}
+		clusters[name] = value
+		if value != "primary" {
+			degraded = append(degraded, name)
+		}
+	}
+	if len(clusters) == 0 {
+		return map[string]interface{}{"state": "standalone"}, nil
+	}
+
+	details := map[string]interface{}{"state": "replicated", "clusters": clusters}
+	if len(degraded) > 0 {
+		sort.Strings(degraded)
+		return details, fmt.Errorf("cluster not primary: %s", strings.Join(degraded, ", "))
+	}
+	return details, nil
+}
@@ -1,73 +1,722 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/embedding"
+	"github.com/arwoosa/post/pkg/logging"
 	"github.com/arwoosa/post/pkg/manticore"
+	openapi "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxSuggestions 每次搜尋最多回傳的建議數量
+	maxSuggestions = 5
+	// defaultLimit 未指定 limit 時每頁的筆數
+	defaultLimit = int32(8)
+	// defaultMaxLimit 未設定 pagination.max_limit 時每頁筆數的上限
+	defaultMaxLimit = int32(50)
+	// defaultMaxMatches 未設定 pagination.max_matches 時的搜尋範圍，與 Manticore 的預設值相同
+	defaultMaxMatches = int32(1000)
 )
 
 // IdeaService 提供 idea 表的特定操作
 type IdeaService struct {
 	client manticore.ManticoreService
 	index  string
+	// autocorrect 為 true 時，零結果的關鍵字搜尋會以最佳建議重新搜尋
+	autocorrect bool
+	// maxLimit 每頁筆數的上限
+	maxLimit int32
+	// maxMatches 頁碼分頁可到達的搜尋範圍
+	maxMatches int32
+	cursors    *cursorCodec
+	embedder   embedding.Embedder
+	profiles   ProfileProvider
+	// rankings 可用 rank 參數選擇的排序方式
+	rankings map[string]RankingProfile
+	// recorder 不為 nil 時記錄每次搜尋的第一頁
+	recorder SearchRecorder
+	// cache 不為 nil 時快取搜尋結果，並在寫入 idea 後清除
+	cache *SearchCache
+	// version 不為 nil 時在寫入 idea 後遞增，用於產生搜尋結果的 ETag
+	version IndexVersion
+	// ideaEvents 不為 nil 時接收 SweepSchedule 產生的事件
+	ideaEvents IdeaEventSink
+	now        func() time.Time
+}
+
+// IdeaServiceOption 設定 IdeaService 的選項
+type IdeaServiceOption func(*IdeaService)
+
+// WithEmbedder 指定計算語意向量的 Embedder，預設為本機的特徵雜湊 Embedder
+func WithEmbedder(embedder embedding.Embedder) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.embedder = embedder
+	}
+}
+
+// WithProfileProvider 指定取得使用者搜尋偏好的 ProfileProvider，預設從設定檔讀取
+func WithProfileProvider(profiles ProfileProvider) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.profiles = profiles
+	}
 }
 
 // NewIdeaService 創建新的 IdeaService 實例
-func NewIdeaService(client manticore.ManticoreService) *IdeaService {
-	return &IdeaService{
-		client: client,
-		index:  "idea",
+func NewIdeaService(client manticore.ManticoreService, opts ...IdeaServiceOption) *IdeaService {
+	svc := &IdeaService{
+		client:      client,
+		index:       "idea",
+		autocorrect: viper.GetBool("search.autocorrect"),
+		maxLimit:    maxLimit(),
+		maxMatches:  maxMatches(),
+		cursors:     newCursorCodec(),
+		embedder:    defaultEmbedder(),
+		rankings:    defaultRankingProfiles,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	if svc.profiles == nil {
+		// 設定格式錯誤時不套用任何個人化偏好
+		if profiles, err := NewConfigProfileProvider(); err == nil {
+			svc.profiles = profiles
+		}
 	}
+	// 設定格式錯誤時只提供內建的排序方式
+	if rankings, err := rankingProfiles(); err == nil {
+		svc.rankings = rankings
+	}
+	return svc
+}
+
+// defaultEmbedder 創建本機的特徵雜湊 Embedder
+func defaultEmbedder() embedding.Embedder {
+	// model.EmbeddingDims 為正數，不會回傳錯誤
+	embedder, _ := embedding.NewHashEmbedder(model.EmbeddingDims)
+	return embedder
+}
+
+// maxLimit 讀取 pagination.max_limit，未設定時使用 defaultMaxLimit
+func maxLimit() int32 {
+	if limit := viper.GetInt32("pagination.max_limit"); limit > 0 {
+		return limit
+	}
+	return defaultMaxLimit
 }
 
-// CreateIdea 創建新的 idea
-func (s *IdeaService) CreateIdea(data *model.IdeaData) (int64, error) {
-	return s.client.Create(s.index, data.ToMap())
+// maxMatches 讀取 pagination.max_matches，未設定時使用 defaultMaxMatches
+func maxMatches() int32 {
+	if matches := viper.GetInt32("pagination.max_matches"); matches > 0 {
+		return matches
+	}
+	return defaultMaxMatches
+}
+
+// CreateIdea 創建新的 idea，新的 idea 為草稿，需經 TransitionIdea 送審與發布
+func (s *IdeaService) CreateIdea(ctx context.Context, data *model.IdeaData) (id int64, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.CreateIdea")
+	defer func() { endSpan(span, err) }()
+
+	now := s.now().Unix()
+	data.Created_at = now
+	data.Updated_at = now
+	data.Status = model.StatusDraft
+	data.Version = 1
+	if err := s.embed(data); err != nil {
+		return 0, err
+	}
+	id, err = s.client.Create(ctx, s.index, data.ToMap())
+	if err != nil {
+		return 0, err
+	}
+	s.invalidate(ctx)
+	return id, nil
+}
+
+// invalidate 清除快取的搜尋結果並遞增索引版本
+func (s *IdeaService) invalidate(ctx context.Context) {
+	invalidateSearch(ctx, s.cache, s.version)
+}
+
+// invalidateSearch 在 idea 被寫入後清除快取的搜尋結果並遞增索引版本，cache 或 version 為 nil 時略過
+func invalidateSearch(ctx context.Context, cache *SearchCache, version IndexVersion) {
+	if cache != nil {
+		cache.Invalidate(ctx)
+	}
+	if version != nil {
+		if err := version.Bump(ctx); err != nil {
+			slog.WarnContext(ctx, "bump index version failed", logging.KeyError, err.Error())
+		}
+	}
+}
+
+// writeLocks 讓同一個程序內對同一個 idea 的「讀取版本、比對、寫入」依序執行。
+// 只在單一實例時保證版本比對：Manticore 的 replace 無法附帶版本條件，
+// 多個實例同時寫入同一個 idea 時可能都通過比對，後寫入的覆蓋先寫入的
+var writeLocks [64]sync.Mutex
+
+// lockIdea 鎖定 id 的寫入，回傳解鎖的函式
+func lockIdea(id int64) func() {
+	lock := &writeLocks[uint64(id)%uint64(len(writeLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// checkVersion 確認 idea 目前的版本為 expected，expected 為 0 時不檢查；
+// current 為 nil 表示 idea 不存在
+func checkVersion(id int64, current *model.IdeaData, expected int64) error {
+	if expected == 0 {
+		return nil
+	}
+	var version int64
+	if current != nil {
+		version = current.Version
+	}
+	if version != expected {
+		return &ConflictError{ID: id, Expected: expected, Current: version}
+	}
+	return nil
 }
 
 // UpdateIdea 更新指定的 idea
-func (s *IdeaService) ReplaceIdea(id int64, data *model.IdeaData) error {
-	return s.client.Replace(s.index, id, data.ToMap())
+// 保留原本的創建時間、狀態、擁有者與熱門度指標，idea 不存在時視為新建的草稿，在資源回收筒中時回傳 ErrIdeaInTrash。
+// data.Version 為客戶端讀取時的版本，與目前的版本不同時回傳 ConflictError，為 0 時不檢查；
+// 寫入後 data.Version 為新的版本。版本比對只在單一實例時有效，見 writeLocks。
+func (s *IdeaService) ReplaceIdea(ctx context.Context, id int64, data *model.IdeaData) (err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.ReplaceIdea", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	unlock := lockIdea(id)
+	defer unlock()
+
+	now := s.now().Unix()
+	current, err := s.readIdea(ctx, id)
+	switch {
+	case errors.Is(err, ErrIdeaNotFound):
+		current = nil
+		data.Created_at = now
+		data.Status = model.StatusDraft
+	case err != nil:
+		return err
+	case current.Deleted_at != 0:
+		return fmt.Errorf("%w: %d", ErrIdeaInTrash, id)
+	default:
+		data.Created_at = current.Created_at
+		data.Status = current.Status
+		data.Owner_id = current.Owner_id
+		data.View_count = current.View_count
+		data.Booking_count = current.Booking_count
+		data.Impression_count = current.Impression_count
+		data.Bookmark_count = current.Bookmark_count
+	}
+	if err := checkVersion(id, current, data.Version); err != nil {
+		return err
+	}
+	data.Version = 1
+	if current != nil {
+		data.Version = current.Version + 1
+	}
+	data.Updated_at = now
+
+	if err := s.embed(data); err != nil {
+		return err
+	}
+	if err := s.client.Replace(ctx, s.index, id, data.ToMap()); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+// embed 計算 idea 的語意向量
+func (s *IdeaService) embed(data *model.IdeaData) error {
+	vector, err := s.embedText(data.EmbeddingText())
+	if err != nil {
+		return err
+	}
+	data.Embedding = vector
+	return nil
+}
+
+// embedText 計算文字的語意向量，並確認維度與 idea 表的向量欄位相同
+func (s *IdeaService) embedText(text string) ([]float32, error) {
+	vector, err := s.embedder.Embed(text)
+	if err != nil {
+		return nil, fmt.Errorf("計算語意向量失敗: %w", err)
+	}
+	if len(vector) != model.EmbeddingDims {
+		return nil, fmt.Errorf("語意向量維度為 %d，應為 %d", len(vector), model.EmbeddingDims)
+	}
+	return vector, nil
+}
+
+// DeleteIdea 將指定的 idea 移到資源回收筒，可以 RestoreIdea 還原，PurgeTrash 才會永久刪除。
+// idea 不存在或已在資源回收筒中時回傳 ErrIdeaNotFound，不比對版本；
+// version 為客戶端讀取時的版本，與目前的版本不同時回傳 ConflictError，為 0 時不檢查。
+// 版本比對只在單一實例時有效，見 writeLocks。
+func (s *IdeaService) DeleteIdea(ctx context.Context, id int64, version int64) (err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.DeleteIdea", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	unlock := lockIdea(id)
+	defer unlock()
+
+	current, err := s.GetIdea(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(id, current, version); err != nil {
+		return err
+	}
+
+	if err := s.client.Update(ctx, s.index, id, map[string]interface{}{
+		"deleted_at": s.now().Unix(),
+		"version":    current.Version + 1,
+	}); err != nil {
+		return err
+	}
+	s.invalidate(ctx)
+	return nil
+}
+
+// GetIdea 取得指定的 idea，不存在或在資源回收筒中時回傳 ErrIdeaNotFound
+func (s *IdeaService) GetIdea(ctx context.Context, id int64) (idea *model.IdeaData, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.GetIdea", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	idea, err = s.readIdea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if idea.Deleted_at != 0 {
+		return nil, fmt.Errorf("%w: %d", ErrIdeaNotFound, id)
+	}
+	return idea, nil
+}
+
+// readIdea 讀取指定的 idea，包含資源回收筒中的 idea，不存在時回傳 ErrIdeaNotFound
+func (s *IdeaService) readIdea(ctx context.Context, id int64) (*model.IdeaData, error) {
+	source, err := s.client.Read(ctx, s.index, id)
+	if errors.Is(err, manticore.ErrDocumentNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrIdeaNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("讀取 idea 失敗: %w", err)
+	}
+	return model.IdeaDataFromMap(uint64(id), source), nil
+}
+
+// SimilarIdeas 搜尋與指定 idea 相似的 ideas，sameRegion 為 true 時只搜尋相同地點；
+// 來源 idea 沒有標籤、野放模式、地點與名稱時回傳空的結果
+func (s *IdeaService) SimilarIdeas(ctx context.Context, id int64, limit int32, sameRegion bool) (response *model.SearchResponse, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.SimilarIdeas", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit < 0 || limit > s.maxLimit {
+		return nil, fmt.Errorf("%w: limit 必須介於 1 到 %d", ErrInvalidLimit, s.maxLimit)
+	}
+
+	source, err := s.GetIdea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRequest := s.queryFactory(nil).CreateSimilarRequest(source, s.index, sameRegion)
+	// 沒有可比對的條件時沒有相似的 idea
+	if searchRequest == nil {
+		return model.FromManticoreResponse(nil), nil
+	}
+	searchRequest.SetLimit(limit)
+
+	result, err := s.client.Search(ctx, searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("執行搜尋失敗: %w", err)
+	}
+	return model.FromManticoreResponse(result), nil
+}
+
+// SearchParams 搜尋 ideas 的參數。
+// Page 大於 0 時使用頁碼分頁 (offset/limit)，否則使用游標分頁 (scroll)。
+type SearchParams struct {
+	// Query URL 編碼的過濾條件，例如 keyword=露營&tags=新手
+	Query string
+	// Cursor 前一頁回傳的 next_cursor，帶入時沿用游標內的查詢條件與排序
+	Cursor string
+	// Limit 游標分頁每頁的筆數，為 0 時使用預設值
+	Limit int32
+	// Page 頁碼分頁的頁碼，從 1 開始
+	Page int32
+	// PageSize 頁碼分頁每頁的筆數，為 0 時使用預設值
+	PageSize int32
+	// Fields 只回傳的欄位，以 "-" 開頭表示排除該欄位，為空時回傳全部欄位
+	Fields []string
+	// Semantic 語意搜尋的文字，不為空時以 KNN 搜尋取代關鍵字搜尋
+	Semantic string
+	// Hybrid 為 true 時，語意搜尋結果會與 BM25 關鍵字搜尋結果融合
+	Hybrid bool
+	// UserID 已通過驗證的使用者 ID，用於取得個人化偏好
+	UserID string
+	// Prefer 明確指定的偏好，會與 UserID 的偏好合併
+	Prefer *UserProfile
+	// Rank 排序方式的名稱，例如 popular、fresh，為空時依 id 或相關度排序
+	Rank string
+	// Statuses 只搜尋這些狀態的 idea，為空時只搜尋已發布的 idea，供管理者搜尋使用
+	Statuses []string
 }
 
-// DeleteIdea 刪除指定的 idea
-func (s *IdeaService) DeleteIdea(id int64) error {
-	return s.client.Delete(s.index, id)
+// SearchIdeas 搜尋 ideas。
+// 每頁筆數超過 pagination.max_limit 時回傳 ErrInvalidLimit；
+// 頁碼分頁超出 pagination.max_matches 的搜尋範圍時回傳 ErrPageOutOfRange。
+// 設定 SearchRecorder 時，成功的搜尋 (包含快取命中) 會被記錄，續頁與管理者搜尋不記錄。
+// 設定 SearchCache 時，非個人化搜尋的第一頁與頁碼分頁會被快取。
+func (s *IdeaService) SearchIdeas(ctx context.Context, params SearchParams) (response *model.SearchResponse, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.SearchIdeas")
+	defer func() { endSpan(span, err) }()
+
+	start := s.now()
+	response, err = s.cachedSearchIdeas(ctx, span, params)
+	if err != nil {
+		return nil, err
+	}
+	s.recordSearch(params, response, start)
+	return response, nil
+}
+
+// RecordNotModified 記錄以 SearchETag 判斷結果未變更而未呼叫 SearchIdeas 的搜尋，start 為收到請求的時間，
+// 搜尋次數才不會因客戶端的條件式請求而減少
+func (s *IdeaService) RecordNotModified(params SearchParams, start time.Time) {
+	s.recordSearch(params, nil, start)
+}
+
+// recordSearch 記錄搜尋的第一頁，續頁與管理者搜尋不記錄；response 為 nil 表示結果未變更
+func (s *IdeaService) recordSearch(params SearchParams, response *model.SearchResponse, start time.Time) {
+	if s.recorder == nil || params.Cursor != "" || params.Page > 1 || len(params.Statuses) > 0 {
+		return
+	}
+	s.recorder.RecordSearch(newSearchRecord(params, response, start, s.now().Sub(start)))
+}
+
+// cachedSearchIdeas 先查詢快取，未命中時搜尋並儲存結果
+func (s *IdeaService) cachedSearchIdeas(ctx context.Context, span trace.Span, params SearchParams) (*model.SearchResponse, error) {
+	if s.cache == nil || !cacheable(params) {
+		return s.searchIdeas(ctx, params)
+	}
+	// 以補上預設值後的參數產生快取鍵，參數錯誤時交由 searchIdeas 回傳
+	normalized := params
+	if err := s.normalize(&normalized); err != nil {
+		return s.searchIdeas(ctx, params)
+	}
+	key := searchCacheKey(normalized)
+	if response, ok := s.cache.get(ctx, key); ok {
+		span.SetAttributes(attribute.Bool("search.cache_hit", true))
+		return response, nil
+	}
+	span.SetAttributes(attribute.Bool("search.cache_hit", false))
+	response, err := s.searchIdeas(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.set(ctx, key, response)
+	return response, nil
+}
+
+func (s *IdeaService) searchIdeas(ctx context.Context, params SearchParams) (*model.SearchResponse, error) {
+	if err := s.normalize(&params); err != nil {
+		return nil, err
+	}
+	projection, err := model.NewProjection(params.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFields, err)
+	}
+	if params.Semantic != "" {
+		return s.semanticSearch(ctx, params, projection)
+	}
+
+	profile, err := s.profile(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.rankings[params.Rank]; params.Rank != "" && !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRank, params.Rank)
+	}
+	page := &cursor{Query: params.Query, Prefer: profile, Rank: params.Rank, Statuses: params.Statuses}
+	if params.Cursor != "" {
+		cur, err := s.cursors.Decode(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if params.Query != "" && params.Query != cur.Query {
+			return nil, fmt.Errorf("%w: 查詢條件與游標不符", ErrInvalidCursor)
+		}
+		// 管理者搜尋的游標不能用於公開搜尋
+		if strings.Join(params.Statuses, ",") != strings.Join(cur.Statuses, ",") {
+			return nil, fmt.Errorf("%w: 狀態條件與游標不符", ErrInvalidCursor)
+		}
+		page = cur
+	}
+
+	filters := decodeQuery(page.Query)
+	response, err := s.search(ctx, filters, page, params, projection)
+	if err != nil {
+		return nil, err
+	}
+
+	// 關鍵字搜尋沒有結果時，提供建議並視設定以最佳建議重新搜尋
+	keyword, ok := filters["keyword"].(string)
+	if response.Total > 0 || params.Cursor != "" || !ok || strings.TrimSpace(keyword) == "" {
+		return response, nil
+	}
+
+	suggestions, err := s.suggestKeyword(ctx, keyword)
+	if err != nil {
+		// 建議只是輔助資訊，失敗時仍回傳原本的搜尋結果
+		return response, nil
+	}
+	response.Suggestions = suggestions
+	if !s.autocorrect || len(suggestions) == 0 {
+		return response, nil
+	}
+
+	filters["keyword"] = suggestions[0]
+	corrected, err := s.search(ctx, filters, &cursor{Query: encodeQuery(filters), Prefer: profile, Rank: params.Rank, Statuses: params.Statuses}, params, projection)
+	if err != nil {
+		return nil, err
+	}
+	if corrected.Total == 0 {
+		return response, nil
+	}
+	corrected.Suggestions = suggestions
+	corrected.Corrected = true
+	corrected.CorrectedKeyword = suggestions[0]
+	return corrected, nil
+}
+
+// profile 合併 UserID 的偏好與明確指定的偏好，沒有任何偏好時回傳 nil
+func (s *IdeaService) profile(params SearchParams) (*UserProfile, error) {
+	var profile *UserProfile
+	if params.UserID != "" && s.profiles != nil {
+		stored, err := s.profiles.Profile(params.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("取得使用者偏好失敗: %w", err)
+		}
+		profile = stored
+	}
+	merged := profile.merge(params.Prefer)
+	if merged.IsEmpty() {
+		return nil, nil
+	}
+	return merged, nil
 }
 
-// SearchIdeas 搜尋 ideas
-func (s *IdeaService) SearchIdeas(query string, scroll string, limit int32) (*model.SearchResponse, error) {
-	filters := decodeQuery(query)
+// normalize 檢查分頁參數並補上預設值
+func (s *IdeaService) normalize(params *SearchParams) error {
+	if err := validateStatuses(params.Statuses); err != nil {
+		return err
+	}
+	if params.Page < 0 {
+		return fmt.Errorf("%w: page 必須大於 0", ErrInvalidPage)
+	}
+	if params.Page > 0 && params.Cursor != "" {
+		return fmt.Errorf("%w: page 不可與 cursor 同時使用", ErrInvalidPage)
+	}
+
+	if params.Page == 0 {
+		if params.Limit == 0 {
+			params.Limit = defaultLimit
+		}
+		if params.Limit < 0 || params.Limit > s.maxLimit {
+			return fmt.Errorf("%w: limit 必須介於 1 到 %d", ErrInvalidLimit, s.maxLimit)
+		}
+		return nil
+	}
+
+	if params.PageSize == 0 {
+		params.PageSize = defaultLimit
+	}
+	if params.PageSize < 0 || params.PageSize > s.maxLimit {
+		return fmt.Errorf("%w: page_size 必須介於 1 到 %d", ErrInvalidLimit, s.maxLimit)
+	}
+	if int64(params.Page)*int64(params.PageSize) > int64(s.maxMatches) {
+		return fmt.Errorf("%w: 第 %d 頁超出搜尋範圍的前 %d 筆", ErrPageOutOfRange, params.Page, s.maxMatches)
+	}
+	return nil
+}
 
+// search 依過濾條件執行一次搜尋，page 為游標分頁目前的位置
+func (s *IdeaService) search(ctx context.Context, filters map[string]interface{}, page *cursor, params SearchParams, projection *model.Projection) (*model.SearchResponse, error) {
 	// 使用查詢工廠創建搜尋請求
-	factory := NewQueryFactory()
-	searchRequest, err := factory.CreateSearchRequest(filters, "idea")
+	factory := s.queryFactory(page.Statuses)
+	searchRequest, err := factory.CreateSearchRequest(ctx, withStatuses(filters, page.Statuses), s.index)
 	if err != nil {
 		return nil, fmt.Errorf("創建搜尋請求失敗: %w", err)
 	}
 
-	if scroll != "" {
-		options := searchRequest.GetOptions()
-		if options == nil {
-			options = make(map[string]interface{})
+	// 依偏好提高相符 idea 的相關度，並套用指定的排序方式，續頁時沿用游標內的設定
+	if !page.Prefer.IsEmpty() {
+		factory.ApplyPreferences(searchRequest, page.Prefer)
+	}
+	ranking, ranked := s.rankings[page.Rank]
+	if ranked {
+		factory.ApplyRanking(searchRequest, ranking)
+	}
+	if page.Sort == nil {
+		switch {
+		case ranked:
+			page.Sort = factory.RankingSort()
+		case !page.Prefer.IsEmpty():
+			page.Sort = factory.RelevanceSort()
+		default:
+			page.Sort = factory.DefaultSort()
 		}
-		options["scroll"] = scroll
-		searchRequest.SetOptions(options)
 	}
+	searchRequest.SetSort(page.Sort)
 
-	if limit > 0 {
-		searchRequest.SetLimit(limit)
+	options := searchRequest.GetOptions()
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	if params.Page > 0 {
+		// 頁碼分頁不使用 scroll
+		delete(options, "scroll")
+		searchRequest.SetOffset((params.Page - 1) * params.PageSize)
+		searchRequest.SetLimit(params.PageSize)
+		searchRequest.SetMaxMatches(s.maxMatches)
+	} else {
+		if page.Scroll != "" {
+			options["scroll"] = page.Scroll
+		}
+		searchRequest.SetLimit(params.Limit)
 	}
+	searchRequest.SetOptions(options)
+
+	applyProjection(searchRequest, params, projection)
 
 	// 執行搜尋
-	result, err := s.client.Search(searchRequest)
+	result, err := s.client.Search(ctx, searchRequest)
 	if err != nil {
 		return nil, fmt.Errorf("執行搜尋失敗: %w", err)
 	}
 
-	return model.FromManticoreResponse(result), nil
+	response := model.FromManticoreResponse(result)
+	if len(params.Fields) > 0 {
+		response.Fields = projection.Fields
+	}
+	if params.Page > 0 {
+		s.paginateByPage(response, params)
+		return response, nil
+	}
+	if err := s.paginate(response, page); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// applyProjection 依 fields 參數設定搜尋請求的 _source
+func applyProjection(searchRequest *openapi.SearchRequest, params SearchParams, projection *model.Projection) {
+	if len(params.Fields) == 0 {
+		return
+	}
+	source := openapi.NewSourceRules()
+	if len(projection.Includes) > 0 {
+		source.SetIncludes(projection.Includes)
+	}
+	if len(projection.Excludes) > 0 {
+		source.SetExcludes(projection.Excludes)
+	}
+	searchRequest.SetSource(source)
+}
+
+// paginateByPage 計算頁碼分頁的總頁數，總頁數以 max_matches 為上限
+func (s *IdeaService) paginateByPage(response *model.SearchResponse, params SearchParams) {
+	reachable := response.Total
+	if reachable > int64(s.maxMatches) {
+		reachable = int64(s.maxMatches)
+	}
+	pageSize := int64(params.PageSize)
+	response.Page = params.Page
+	response.TotalPages = (reachable + pageSize - 1) / pageSize
+	response.HasMore = int64(params.Page) < response.TotalPages
+}
+
+// paginate 依目前位置計算 has_more，並在還有下一頁時產生 next_cursor
+func (s *IdeaService) paginate(response *model.SearchResponse, page *cursor) error {
+	position := page.Position + int64(len(response.Data))
+	response.HasMore = response.Scroll != "" && len(response.Data) > 0 && position < response.Total
+	if !response.HasMore {
+		return nil
+	}
+
+	next, err := s.cursors.Encode(&cursor{
+		Query:    page.Query,
+		Prefer:   page.Prefer,
+		Rank:     page.Rank,
+		Statuses: page.Statuses,
+		Sort:     page.Sort,
+		Scroll:   response.Scroll,
+		Position: position,
+	})
+	if err != nil {
+		return err
+	}
+	response.NextCursor = next
+	return nil
+}
+
+// suggestKeyword 對關鍵字的每個詞呼叫 Suggest，組合出完整的建議關鍵字
+// 第一個建議由每個詞的最佳建議組成
+func (s *IdeaService) suggestKeyword(ctx context.Context, keyword string) ([]string, error) {
+	terms := strings.Fields(keyword)
+	candidates := make([][]string, len(terms))
+	depth := 0
+	for i, term := range terms {
+		words, err := s.client.Suggest(ctx, s.index, term, maxSuggestions)
+		if err != nil {
+			return nil, fmt.Errorf("取得建議失敗: %w", err)
+		}
+		candidates[i] = words
+		if len(words) > depth {
+			depth = len(words)
+		}
+	}
+
+	suggestions := make([]string, 0, depth)
+	seen := map[string]bool{keyword: true}
+	for n := 0; n < depth && len(suggestions) < maxSuggestions; n++ {
+		parts := make([]string, len(terms))
+		for i, term := range terms {
+			switch {
+			case n < len(candidates[i]):
+				parts[i] = candidates[i][n]
+			case len(candidates[i]) > 0:
+				parts[i] = candidates[i][0]
+			default:
+				parts[i] = term
+			}
+		}
+		suggestion := strings.Join(parts, " ")
+		if !seen[suggestion] {
+			seen[suggestion] = true
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	return suggestions, nil
 }
 
 // decodeQuery 解析 query 參數
@@ -84,3 +733,12 @@ func decodeQuery(query string) map[string]interface{} {
 
 	return filters
 }
+
+// encodeQuery 將過濾條件編碼回 query 參數
+func encodeQuery(filters map[string]interface{}) string {
+	params := url.Values{}
+	for key, value := range filters {
+		params.Set(key, fmt.Sprint(value))
+	}
+	return params.Encode()
+}
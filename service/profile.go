@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// UserProfile 使用者的搜尋偏好，只用於調整排序，不會過濾任何結果
+type UserProfile struct {
+	PreferModes []string `json:"m,omitempty" mapstructure:"prefer_modes"`
+	PreferTags  []string `json:"t,omitempty" mapstructure:"prefer_tags"`
+}
+
+// IsEmpty 表示沒有任何偏好
+func (p *UserProfile) IsEmpty() bool {
+	return p == nil || (len(p.PreferModes) == 0 && len(p.PreferTags) == 0)
+}
+
+// merge 合併另一份偏好，並移除重複與空白的值
+func (p *UserProfile) merge(other *UserProfile) *UserProfile {
+	merged := &UserProfile{}
+	for _, profile := range []*UserProfile{p, other} {
+		if profile == nil {
+			continue
+		}
+		merged.PreferModes = appendUnique(merged.PreferModes, profile.PreferModes...)
+		merged.PreferTags = appendUnique(merged.PreferTags, profile.PreferTags...)
+	}
+	return merged
+}
+
+func appendUnique(values []string, items ...string) []string {
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		exists := false
+		for _, value := range values {
+			if value == item {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// ProfileProvider 依使用者 ID 取得搜尋偏好
+type ProfileProvider interface {
+	// Profile 取得使用者的偏好，沒有偏好時回傳 nil
+	Profile(userID string) (*UserProfile, error)
+}
+
+type configProfileProvider struct {
+	profiles map[string]*UserProfile
+}
+
+// NewConfigProfileProvider 創建從設定檔 personalization.profiles 讀取偏好的 ProfileProvider
+func NewConfigProfileProvider() (ProfileProvider, error) {
+	profiles := make(map[string]*UserProfile)
+	if err := viper.UnmarshalKey("personalization.profiles", &profiles); err != nil {
+		return nil, fmt.Errorf("讀取 personalization.profiles 失敗: %w", err)
+	}
+	return &configProfileProvider{profiles: profiles}, nil
+}
+
+// Profile 實現 ProfileProvider
+func (p *configProfileProvider) Profile(userID string) (*UserProfile, error) {
+	return p.profiles[userID], nil
+}
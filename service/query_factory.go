@@ -1,10 +1,15 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/arwoosa/post/model"
 	openapi "github.com/manticoresoftware/manticoresearch-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // FieldType 定義欄位類型
@@ -44,6 +49,8 @@ type Filter struct {
 // QueryFactory 用於創建不同類型的查詢條件
 type QueryFactory struct {
 	fieldDefinitions map[string]FieldDefinition
+	// windowAt 不為 0 時，搜尋只包含在該 Unix 時間已發布且未到期的 idea
+	windowAt int64
 }
 
 // NewQueryFactory 創建新的查詢工廠
@@ -70,27 +77,34 @@ func NewQueryFactory() *QueryFactory {
 				Type: RangeField,
 				Name: "experience_hours",
 			},
+			"status": {
+				Type: Attribute,
+				Name: "status",
+			},
 		},
 	}
 }
 
+// WithTimeWindow 讓之後創建的搜尋請求只包含在 now 時已到 publish_at 且未到 expire_at 的 idea，
+// 用於公開搜尋；管理者搜尋不設定，才看得到尚未發布與已到期的 idea
+func (f *QueryFactory) WithTimeWindow(now time.Time) *QueryFactory {
+	f.windowAt = now.Unix()
+	return f
+}
+
 // CreateSearchRequest 根據過濾條件創建搜尋請求
-func (f *QueryFactory) CreateSearchRequest(filters map[string]interface{}, index string) (*openapi.SearchRequest, error) {
-	searchRequest := openapi.NewSearchRequest(index)
+func (f *QueryFactory) CreateSearchRequest(ctx context.Context, filters map[string]interface{}, index string) (searchRequest *openapi.SearchRequest, err error) {
+	_, span := tracer.Start(ctx, "QueryFactory.CreateSearchRequest", trace.WithAttributes(attribute.Int("query.filters", len(filters))))
+	defer func() { endSpan(span, err) }()
+
+	searchRequest = openapi.NewSearchRequest(index)
 	query := openapi.NewSearchQuery()
 	boolFilter := openapi.NewBoolFilter()
 
 	// 設定選項
 	options := map[string]interface{}{
-		"field_weights": map[string]int{
-			"name":               6,
-			"rewilding_mode":     4,
-			"rewilding_location": 4,
-			"rewilding_name":     3,
-			"tags":               2,
-			"host_message":       1,
-		},
-		"scroll": true,
+		"field_weights": fieldWeights(),
+		"scroll":        true,
 	}
 	searchRequest.SetOptions(options)
 
@@ -130,6 +144,10 @@ func (f *QueryFactory) CreateSearchRequest(filters map[string]interface{}, index
 		}
 	}
 
+	// 預設排除資源回收筒中的 idea
+	must = append(must, liveFilter())
+	must = append(must, f.windowFilters()...)
+
 	// 設置布林查詢條件
 	boolFilter.SetMust(must)
 	// if len(should) > 0 {
@@ -140,14 +158,255 @@ func (f *QueryFactory) CreateSearchRequest(filters map[string]interface{}, index
 	searchRequest.SetQuery(*query)
 
 	// 設置排序
-	sort := map[string]string{
-		"id": "asc",
+	searchRequest.SetSort(f.DefaultSort())
+
+	return searchRequest, nil
+}
+
+// CreateSimilarRequest 以來源 idea 的標籤、野放模式、地點與名稱關鍵詞創建「相似 idea」搜尋請求。
+// 結果依 field_weights 計算的相關度排序並排除來源 idea；sameRegion 為 true 時只搜尋相同地點。
+// 來源 idea 沒有任何可比對的條件時回傳 nil，空的 should 會符合所有 idea。
+func (f *QueryFactory) CreateSimilarRequest(source *model.IdeaData, index string, sameRegion bool) *openapi.SearchRequest {
+	searchRequest := openapi.NewSearchRequest(index)
+	searchRequest.SetOptions(map[string]interface{}{
+		"field_weights": fieldWeights(),
+	})
+
+	// 任一條件符合即視為相似，符合越多相關度越高
+	should := make([]*openapi.QueryFilter, 0)
+	for _, tag := range strings.Split(source.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			should = append(should, matchFilter("tags", tag, "and"))
+		}
+	}
+	if source.Rewilding_mode != "" {
+		should = append(should, matchFilter("rewilding_mode", source.Rewilding_mode, "and"))
+	}
+	if source.Rewilding_location != "" {
+		should = append(should, matchFilter("rewilding_location", source.Rewilding_location, "and"))
+	}
+	if terms := strings.TrimSpace(source.Name + " " + source.Rewilding_name); terms != "" {
+		should = append(should, matchFilter("name,rewilding_name,host_message", terms, "or"))
+	}
+	if len(should) == 0 {
+		return nil
 	}
-	searchRequest.SetSort(sort)
 
+	// 有 must 時 should 會被忽略，因此將 should 包成一個 must 條件
+	must := []openapi.QueryFilter{
+		{Bool: &openapi.BoolFilter{Should: should}},
+	}
+	if sameRegion {
+		must = append(must, openapi.QueryFilter{
+			Equals: map[string]interface{}{
+				"rewilding_location": source.Rewilding_location,
+			},
+		})
+	}
+	// 只推薦已發布的 idea
+	must = append(must, liveFilter(), openapi.QueryFilter{
+		Equals: map[string]interface{}{"status": model.StatusPublished},
+	})
+	must = append(must, f.windowFilters()...)
+
+	boolFilter := openapi.NewBoolFilter()
+	boolFilter.SetMust(must)
+	boolFilter.SetMustNot([]*openapi.QueryFilter{
+		{Equals: map[string]interface{}{"id": source.ID}},
+	})
+
+	query := openapi.NewSearchQuery()
+	query.SetBool(*boolFilter)
+	searchRequest.SetQuery(*query)
+	searchRequest.SetSort(f.RelevanceSort())
+
+	return searchRequest
+}
+
+// CreateTrashRequest 創建列出資源回收筒的搜尋請求，結果依刪除時間由新到舊排序；
+// deletedBefore 大於 0 時只列出在該 Unix 時間之前刪除的 idea，ownerID 不為空時只列出該使用者擁有的 idea
+func (f *QueryFactory) CreateTrashRequest(index string, deletedBefore int64, ownerID string) *openapi.SearchRequest {
+	deletedAt := map[string]interface{}{"gt": 0}
+	if deletedBefore > 0 {
+		deletedAt["lt"] = deletedBefore
+	}
+	must := []openapi.QueryFilter{
+		{Range: map[string]interface{}{"deleted_at": deletedAt}},
+	}
+	if ownerID != "" {
+		must = append(must, openapi.QueryFilter{Equals: map[string]interface{}{"owner_id": ownerID}})
+	}
+	boolFilter := openapi.NewBoolFilter()
+	boolFilter.SetMust(must)
+
+	query := openapi.NewSearchQuery()
+	query.SetBool(*boolFilter)
+	searchRequest := openapi.NewSearchRequest(index)
+	searchRequest.SetQuery(*query)
+	searchRequest.SetSort([]map[string]string{
+		{"deleted_at": "desc"},
+		{"id": "asc"},
+	})
+	return searchRequest
+}
+
+// CreateScheduleRequest 創建列出已發布且 field (publish_at 或 expire_at) 介於 (after, until] 的 idea 的搜尋請求，
+// 結果依 field 由早到晚排序
+func (f *QueryFactory) CreateScheduleRequest(index string, field string, after int64, until int64) *openapi.SearchRequest {
+	boolFilter := openapi.NewBoolFilter()
+	boolFilter.SetMust([]openapi.QueryFilter{
+		{Range: map[string]interface{}{
+			field: map[string]interface{}{"gt": after, "lte": until},
+		}},
+		{Equals: map[string]interface{}{"status": model.StatusPublished}},
+		liveFilter(),
+	})
+
+	query := openapi.NewSearchQuery()
+	query.SetBool(*boolFilter)
+	searchRequest := openapi.NewSearchRequest(index)
+	searchRequest.SetQuery(*query)
+	searchRequest.SetSort([]map[string]string{
+		{field: "asc"},
+		{"id": "asc"},
+	})
+	return searchRequest
+}
+
+// windowFilters 回傳 WithTimeWindow 設定的時間條件，publish_at 與 expire_at 為 0 表示不限制
+func (f *QueryFactory) windowFilters() []openapi.QueryFilter {
+	if f.windowAt == 0 {
+		return nil
+	}
+	return []openapi.QueryFilter{
+		{Range: map[string]interface{}{
+			"publish_at": map[string]interface{}{"lte": f.windowAt},
+		}},
+		{Bool: &openapi.BoolFilter{Should: []*openapi.QueryFilter{
+			{Equals: map[string]interface{}{"expire_at": 0}},
+			{Range: map[string]interface{}{
+				"expire_at": map[string]interface{}{"gt": f.windowAt},
+			}},
+		}}},
+	}
+}
+
+// liveFilter 排除已軟刪除的 idea，deleted_at 為 0 表示未刪除
+func liveFilter() openapi.QueryFilter {
+	return openapi.QueryFilter{
+		Equals: map[string]interface{}{"deleted_at": 0},
+	}
+}
+
+// CreateKnnRequest 創建 KNN 搜尋請求，filters 作為 KNN 的過濾條件，結果依向量距離排序
+func (f *QueryFactory) CreateKnnRequest(ctx context.Context, filters map[string]interface{}, index string, vector []float32, k int32) (*openapi.SearchRequest, error) {
+	searchRequest, err := f.CreateSearchRequest(ctx, filters, index)
+	if err != nil {
+		return nil, err
+	}
+
+	knn := openapi.NewKnnQuery("embedding", k)
+	knn.SetQueryVector(vector)
+	if query := searchRequest.Query; query != nil && query.Bool != nil && len(query.Bool.Must) > 0 {
+		knn.SetFilter(openapi.QueryFilter{Bool: query.Bool})
+	}
+
+	searchRequest.Query = nil
+	searchRequest.Sort = nil
+	delete(searchRequest.Options, "scroll")
+	searchRequest.SetKnn(*knn)
+	searchRequest.SetLimit(k)
 	return searchRequest, nil
 }
 
+// ApplyPreferences 依使用者偏好提高相符 idea 的相關度。
+// 偏好條件放在一個包含 match_all 的 should 中，因此永遠成立，只影響 _score 而不過濾結果；
+// 需搭配 RelevanceSort 排序才會生效。
+func (f *QueryFactory) ApplyPreferences(searchRequest *openapi.SearchRequest, profile *UserProfile) {
+	should := make([]*openapi.QueryFilter, 0, len(profile.PreferModes)+len(profile.PreferTags)+1)
+	for _, mode := range profile.PreferModes {
+		should = append(should, matchFilter("rewilding_mode", mode, "and"))
+	}
+	for _, tag := range profile.PreferTags {
+		should = append(should, matchFilter("tags", tag, "and"))
+	}
+	should = append(should, &openapi.QueryFilter{MatchAll: map[string]interface{}{}})
+
+	query := searchRequest.GetQuery()
+	boolFilter := query.GetBool()
+	boolFilter.SetMust(append(boolFilter.GetMust(), openapi.QueryFilter{
+		Bool: &openapi.BoolFilter{Should: should},
+	}))
+	query.SetBool(boolFilter)
+	searchRequest.SetQuery(query)
+}
+
+// ApplyRanking 套用排序方式的 ranker 與運算式，需搭配 RankingSort 排序
+func (f *QueryFactory) ApplyRanking(searchRequest *openapi.SearchRequest, profile RankingProfile) {
+	expressions := searchRequest.GetExpressions()
+	if expressions == nil {
+		expressions = make(map[string]string)
+	}
+	expressions[rankScore] = profile.Expression
+	searchRequest.SetExpressions(expressions)
+
+	if profile.Ranker != "" {
+		options := searchRequest.GetOptions()
+		if options == nil {
+			options = make(map[string]interface{})
+		}
+		options["ranker"] = profile.Ranker
+		searchRequest.SetOptions(options)
+	}
+}
+
+// RankingSort 回傳依排序運算式排序，同分時依 id 排序
+func (f *QueryFactory) RankingSort() []map[string]string {
+	return []map[string]string{
+		{rankScore: "desc"},
+		{"id": "asc"},
+	}
+}
+
+// RelevanceSort 回傳依相關度排序，同分時依 id 排序
+func (f *QueryFactory) RelevanceSort() []map[string]string {
+	return []map[string]string{
+		{"_score": "desc"},
+		{"id": "asc"},
+	}
+}
+
+// DefaultSort 回傳搜尋的預設排序
+func (f *QueryFactory) DefaultSort() []map[string]string {
+	return []map[string]string{
+		{"id": "asc"},
+	}
+}
+
+// fieldWeights 回傳全文搜索各欄位的權重
+func fieldWeights() map[string]int {
+	return map[string]int{
+		"name":               6,
+		"rewilding_mode":     4,
+		"rewilding_location": 4,
+		"rewilding_name":     3,
+		"tags":               2,
+		"host_message":       1,
+	}
+}
+
+// matchFilter 創建單一欄位的全文匹配條件
+func matchFilter(field string, query string, operator string) *openapi.QueryFilter {
+	return &openapi.QueryFilter{
+		Match: map[string]interface{}{
+			field: map[string]interface{}{
+				"query":    query,
+				"operator": operator,
+			},
+		},
+	}
+}
+
 // handleFullText 處理全文搜索
 func (f *QueryFactory) handleFullText(value interface{}) (*openapi.QueryFilter, error) {
 	if keyword, ok := value.(string); ok {
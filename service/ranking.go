@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// rankScore 排序用運算式的名稱
+const rankScore = "rank_score"
+
+// RankingProfile 定義一種排序方式，Expression 為 Manticore 運算式，結果依其值由大到小排序
+type RankingProfile struct {
+	// Ranker 為 Manticore 的 ranker，例如 proximity_bm25、bm25，為空時使用預設值
+	Ranker     string `mapstructure:"ranker"`
+	Expression string `mapstructure:"expression"`
+}
+
+// defaultRankingProfiles 內建的排序方式，可由設定檔 ranking.profiles 覆寫或新增
+var defaultRankingProfiles = map[string]RankingProfile{
+	// popular 以文字相關度加上瀏覽與預訂次數排序
+	"popular": {
+		Ranker:     "proximity_bm25",
+		Expression: "weight() + 200*log10(view_count+1) + 500*log10(booking_count+1)",
+	},
+	// fresh 以文字相關度加上更新時間排序，分數約每 7 天減半
+	"fresh": {
+		Ranker:     "proximity_bm25",
+		Expression: "weight() + 1000*exp(-0.693*(now()-updated_at)/604800)",
+	},
+}
+
+// rankingProfiles 合併內建與設定檔 ranking.profiles 的排序方式
+func rankingProfiles() (map[string]RankingProfile, error) {
+	profiles := make(map[string]RankingProfile, len(defaultRankingProfiles))
+	for name, profile := range defaultRankingProfiles {
+		profiles[name] = profile
+	}
+
+	configured := make(map[string]RankingProfile)
+	if err := viper.UnmarshalKey("ranking.profiles", &configured); err != nil {
+		return nil, fmt.Errorf("讀取 ranking.profiles 失敗: %w", err)
+	}
+	for name, profile := range configured {
+		if profile.Expression == "" {
+			return nil, fmt.Errorf("ranking.profiles.%s.expression 不可為空", name)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
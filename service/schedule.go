@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/logging"
+	openapi "github.com/manticoresoftware/manticoresearch-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// sweepBatchSize SweepSchedule 每次搜尋的筆數
+const sweepBatchSize = 100
+
+// IdeaEventSink 接收 idea 的生命週期事件，例如 *eventlog.Store
+type IdeaEventSink interface {
+	Append(records ...interface{}) error
+}
+
+// WithIdeaEvents 指定接收 SweepSchedule 產生的 idea 事件，未指定時不發送事件
+func WithIdeaEvents(sink IdeaEventSink) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.ideaEvents = sink
+	}
+}
+
+// queryFactory 創建查詢工廠，公開搜尋 (未指定狀態) 只包含目前在顯示期間內的 idea
+func (s *IdeaService) queryFactory(statuses []string) *QueryFactory {
+	factory := NewQueryFactory()
+	if len(statuses) == 0 {
+		factory.WithTimeWindow(s.now())
+	}
+	return factory
+}
+
+// SweepSchedule 處理排程的 idea 並回傳到期下架的筆數：
+// 已到 expire_at 的已發布 idea 改為 archived；
+// 在 since 之後到了 publish_at 的 idea 不會改變索引，因此清除快取讓公開搜尋立即看到。
+// 兩者都會發送 IdeaEvent，事件發送失敗只記錄警告。
+func (s *IdeaService) SweepSchedule(ctx context.Context, since time.Time) (expired int, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.SweepSchedule")
+	defer func() {
+		span.SetAttributes(attribute.Int("schedule.expired", expired))
+		endSpan(span, err)
+	}()
+
+	now := s.now()
+	var events []interface{}
+	defer func() { s.publishIdeaEvents(ctx, events) }()
+
+	factory := NewQueryFactory()
+	for offset := int32(0); ; offset += sweepBatchSize {
+		searchRequest := factory.CreateScheduleRequest(s.index, "publish_at", since.Unix(), now.Unix())
+		ideas, err := s.sweepBatch(ctx, searchRequest, offset)
+		if err != nil {
+			return expired, err
+		}
+		for _, idea := range ideas {
+			events = append(events, model.IdeaEvent{Type: model.IdeaEventPublished, IdeaID: idea.ID, Timestamp: now.Unix()})
+		}
+		if len(ideas) < sweepBatchSize {
+			break
+		}
+	}
+	if len(events) > 0 {
+		s.invalidate(ctx)
+	}
+
+	// 下架後就不再符合搜尋條件，因此每次都從頭搜尋
+	seen := make(map[uint64]bool)
+	for {
+		searchRequest := factory.CreateScheduleRequest(s.index, "expire_at", 0, now.Unix())
+		ideas, err := s.sweepBatch(ctx, searchRequest, 0)
+		if err != nil {
+			return expired, err
+		}
+		if len(ideas) == 0 {
+			return expired, nil
+		}
+		for _, idea := range ideas {
+			// 已處理的 idea 再次出現表示下架沒有生效，避免無限迴圈
+			if seen[idea.ID] {
+				return expired, fmt.Errorf("idea %d 下架後仍在排程搜尋結果中", idea.ID)
+			}
+			seen[idea.ID] = true
+			_, err := s.TransitionIdea(ctx, int64(idea.ID), model.StatusArchived, 0)
+			// 搜尋後被其他人變更狀態或刪除的 idea 不需要下架
+			if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrIdeaNotFound) {
+				continue
+			}
+			if err != nil {
+				return expired, err
+			}
+			expired++
+			events = append(events, model.IdeaEvent{Type: model.IdeaEventExpired, IdeaID: idea.ID, Timestamp: now.Unix()})
+		}
+	}
+}
+
+// RunScheduleSweeper 每隔 interval 執行一次 SweepSchedule，直到 ctx 結束
+func (s *IdeaService) RunScheduleSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	since := s.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := s.now()
+			if _, err := s.SweepSchedule(ctx, since); err != nil {
+				slog.WarnContext(ctx, "sweep scheduled ideas failed", logging.KeyError, err.Error())
+				continue
+			}
+			since = now
+		}
+	}
+}
+
+// sweepBatch 執行排程搜尋的一頁
+func (s *IdeaService) sweepBatch(ctx context.Context, searchRequest *openapi.SearchRequest, offset int32) ([]model.IdeaResponse, error) {
+	searchRequest.SetLimit(sweepBatchSize)
+	searchRequest.SetOffset(offset)
+	result, err := s.client.Search(ctx, searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("執行搜尋失敗: %w", err)
+	}
+	return model.FromManticoreResponse(result).Data, nil
+}
+
+// publishIdeaEvents 發送 idea 事件，未設定 IdeaEventSink 時忽略
+func (s *IdeaService) publishIdeaEvents(ctx context.Context, events []interface{}) {
+	if s.ideaEvents == nil || len(events) == 0 {
+		return
+	}
+	if err := s.ideaEvents.Append(events...); err != nil {
+		slog.WarnContext(ctx, "publish idea events failed", logging.KeyError, err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/arwoosa/post/model"
+)
+
+const (
+	// rrfK 為 Reciprocal Rank Fusion 的平滑常數
+	rrfK = 60
+	// hybridCandidates 混合搜尋時，每種搜尋取回的候選筆數為 limit 的倍數
+	hybridCandidates = 3
+)
+
+// semanticSearch 以 KNN 搜尋與 params.Semantic 語意相近的 ideas。
+// Hybrid 為 true 時，另外執行 BM25 關鍵字搜尋，並以 Reciprocal Rank Fusion 融合兩者的排名。
+// 語意搜尋只回傳最相近的 limit 筆，不支援分頁。
+func (s *IdeaService) semanticSearch(ctx context.Context, params SearchParams, projection *model.Projection) (*model.SearchResponse, error) {
+	if params.Cursor != "" || params.Page > 0 {
+		return nil, fmt.Errorf("%w: 語意搜尋不支援分頁", ErrInvalidPage)
+	}
+
+	vector, err := s.embedText(params.Semantic)
+	if err != nil {
+		return nil, err
+	}
+
+	// 關鍵字只用於 BM25 搜尋，其餘條件作為 KNN 的過濾條件
+	filters := withStatuses(decodeQuery(params.Query), params.Statuses)
+	keyword, _ := filters["keyword"].(string)
+	delete(filters, "keyword")
+
+	k := params.Limit
+	if params.Hybrid {
+		k = params.Limit * hybridCandidates
+	}
+
+	factory := s.queryFactory(params.Statuses)
+	knnRequest, err := factory.CreateKnnRequest(ctx, filters, s.index, vector, k)
+	if err != nil {
+		return nil, fmt.Errorf("創建搜尋請求失敗: %w", err)
+	}
+	applyProjection(knnRequest, params, projection)
+
+	knnResult, err := s.client.Search(ctx, knnRequest)
+	if err != nil {
+		return nil, fmt.Errorf("執行搜尋失敗: %w", err)
+	}
+	response := model.FromManticoreResponse(knnResult)
+
+	if params.Hybrid {
+		if keyword == "" {
+			keyword = params.Semantic
+		}
+		filters["keyword"] = keyword
+		textRequest, err := factory.CreateSearchRequest(ctx, filters, s.index)
+		if err != nil {
+			return nil, fmt.Errorf("創建搜尋請求失敗: %w", err)
+		}
+		delete(textRequest.Options, "scroll")
+		textRequest.SetSort(factory.RelevanceSort())
+		textRequest.SetLimit(k)
+		applyProjection(textRequest, params, projection)
+
+		textResult, err := s.client.Search(ctx, textRequest)
+		if err != nil {
+			return nil, fmt.Errorf("執行搜尋失敗: %w", err)
+		}
+		response.Data = fuse(response.Data, model.FromManticoreResponse(textResult).Data)
+		response.Total = int64(len(response.Data))
+	}
+
+	if len(response.Data) > int(params.Limit) {
+		response.Data = response.Data[:params.Limit]
+	}
+	if len(params.Fields) > 0 {
+		response.Fields = projection.Fields
+	}
+	return response, nil
+}
+
+// fuse 以 Reciprocal Rank Fusion 融合多個排名，同分時保持第一個排名的順序
+func fuse(rankings ...[]model.IdeaResponse) []model.IdeaResponse {
+	scores := make(map[uint64]float64)
+	ideas := make([]model.IdeaResponse, 0)
+	for _, ranking := range rankings {
+		for rank, idea := range ranking {
+			if _, ok := scores[idea.ID]; !ok {
+				ideas = append(ideas, idea)
+			}
+			scores[idea.ID] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	sort.SliceStable(ideas, func(i, j int) bool {
+		return scores[ideas[i].ID] > scores[ideas[j].ID]
+	})
+	return ideas
+}
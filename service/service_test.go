@@ -1 +1,1566 @@
 package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"github.com/arwoosa/post/pkg/cache"
+	"github.com/arwoosa/post/pkg/eventlog"
+	"github.com/arwoosa/post/pkg/manticore"
+	manticoresearch "github.com/manticoresoftware/manticoresearch-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	nooptrace "go.opentelemetry.io/otel/trace/noop"
+)
+
+// mockManticore 以函式欄位模擬 manticore.ManticoreService
+type mockManticore struct {
+	createFunc  func(index string, data map[string]interface{}) (int64, error)
+	readFunc    func(index string, id int64) (map[string]interface{}, error)
+	replaceFunc func(index string, id int64, data map[string]interface{}) error
+	updateFunc  func(index string, id int64, data map[string]interface{}) error
+	deleteFunc  func(index string, id int64) error
+	searchFunc  func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error)
+	suggestFunc func(index string, word string, limit int) ([]string, error)
+}
+
+func (m *mockManticore) Create(ctx context.Context, index string, data map[string]interface{}) (int64, error) {
+	if m.createFunc == nil {
+		return 0, nil
+	}
+	return m.createFunc(index, data)
+}
+
+func (m *mockManticore) Read(ctx context.Context, index string, id int64) (map[string]interface{}, error) {
+	if m.readFunc == nil {
+		return nil, manticore.ErrDocumentNotFound
+	}
+	return m.readFunc(index, id)
+}
+
+func (m *mockManticore) Replace(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	if m.replaceFunc == nil {
+		return nil
+	}
+	return m.replaceFunc(index, id, data)
+}
+
+func (m *mockManticore) Update(ctx context.Context, index string, id int64, data map[string]interface{}) error {
+	if m.updateFunc == nil {
+		return nil
+	}
+	return m.updateFunc(index, id, data)
+}
+
+func (m *mockManticore) Delete(ctx context.Context, index string, id int64) error {
+	if m.deleteFunc == nil {
+		return nil
+	}
+	return m.deleteFunc(index, id)
+}
+
+func (m *mockManticore) Search(ctx context.Context, searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+	if m.searchFunc == nil {
+		return searchResponse(), nil
+	}
+	return m.searchFunc(searchRequest)
+}
+
+func (m *mockManticore) Suggest(ctx context.Context, index string, word string, limit int) ([]string, error) {
+	if m.suggestFunc == nil {
+		return nil, nil
+	}
+	return m.suggestFunc(index, word, limit)
+}
+
+func (m *mockManticore) Health(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// searchResponse 以 id 與名稱組出 Manticore 搜尋結果
+func searchResponse(names ...string) *manticoresearch.SearchResponse {
+	hits := make([]map[string]interface{}, 0, len(names))
+	for i, name := range names {
+		hits = append(hits, map[string]interface{}{
+			"_id":     float64(i + 1),
+			"_source": map[string]interface{}{"name": name},
+		})
+	}
+	total := int32(len(names))
+	return &manticoresearch.SearchResponse{
+		Hits: &manticoresearch.SearchResponseHits{
+			Total: &total,
+			Hits:  hits,
+		},
+	}
+}
+
+// keywordOf 取出搜尋請求中全文搜索的關鍵字
+func keywordOf(searchRequest *manticoresearch.SearchRequest) string {
+	for _, filter := range searchRequest.Query.Bool.Must {
+		if match, ok := filter.Match.(map[string]interface{}); ok {
+			if all, ok := match["*"].(map[string]interface{}); ok {
+				return all["query"].(string)
+			}
+		}
+	}
+	return ""
+}
+
+func TestSearchIdeasSuggestions(t *testing.T) {
+	defer viper.Set("search.autocorrect", false)
+
+	suggest := func(index string, word string, limit int) ([]string, error) {
+		switch word {
+		case "露瑩":
+			return []string{"露營", "露天"}, nil
+		case "登三":
+			return []string{"登山"}, nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		autocorrect      bool
+		results          map[string][]string
+		wantTotal        int64
+		wantSuggestions  []string
+		wantCorrected    bool
+		wantCorrectedKey string
+	}{
+		{
+			name:      "results found",
+			query:     "keyword=露營",
+			results:   map[string][]string{"露營": {"森林露營"}},
+			wantTotal: 1,
+		},
+		{
+			name:      "no keyword",
+			query:     "rewilding_mode=露營",
+			wantTotal: 0,
+		},
+		{
+			name:            "suggestions only",
+			query:           "keyword=露瑩 登三",
+			wantSuggestions: []string{"露營 登山", "露天 登山"},
+		},
+		{
+			name:             "autocorrect",
+			query:            "keyword=露瑩 登三",
+			autocorrect:      true,
+			results:          map[string][]string{"露營 登山": {"森林露營", "百岳登山"}},
+			wantTotal:        2,
+			wantSuggestions:  []string{"露營 登山", "露天 登山"},
+			wantCorrected:    true,
+			wantCorrectedKey: "露營 登山",
+		},
+		{
+			name:            "autocorrect without results",
+			query:           "keyword=露瑩",
+			autocorrect:     true,
+			wantSuggestions: []string{"露營", "露天"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("search.autocorrect", test.autocorrect)
+			client := &mockManticore{
+				searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+					return searchResponse(test.results[keywordOf(searchRequest)]...), nil
+				},
+				suggestFunc: suggest,
+			}
+
+			svc := NewIdeaService(client)
+			response, err := svc.SearchIdeas(context.Background(), SearchParams{Query: test.query, Limit: 8})
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantTotal, response.Total)
+			assert.Equal(t, test.wantSuggestions, response.Suggestions)
+			assert.Equal(t, test.wantCorrected, response.Corrected)
+			assert.Equal(t, test.wantCorrectedKey, response.CorrectedKeyword)
+		})
+	}
+}
+
+func TestCursorCodec(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	codec := &cursorCodec{
+		secret: []byte("secret"),
+		ttl:    time.Minute,
+		now:    func() time.Time { return now },
+	}
+
+	token, err := codec.Encode(&cursor{Query: "keyword=露營", Sort: []map[string]string{{"id": "asc"}}, Scroll: "abc", Position: 8})
+	assert.NoError(t, err)
+
+	cur, err := codec.Decode(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "keyword=露營", cur.Query)
+	assert.Equal(t, []map[string]string{{"id": "asc"}}, cur.Sort)
+	assert.Equal(t, "abc", cur.Scroll)
+	assert.Equal(t, int64(8), cur.Position)
+
+	// 竄改內容
+	payload, signature, _ := strings.Cut(token, ".")
+	_, err = codec.Decode(payload + "x." + signature)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// 其他金鑰簽署
+	other := &cursorCodec{secret: []byte("other"), ttl: time.Minute, now: codec.now}
+	_, err = other.Decode(token)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// 格式錯誤
+	_, err = codec.Decode("not-a-cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// 過期
+	now = now.Add(2 * time.Minute)
+	_, err = codec.Decode(token)
+	assert.ErrorIs(t, err, ErrCursorExpired)
+}
+
+func TestSearchIdeasPagination(t *testing.T) {
+	defer viper.Set("pagination.max_limit", 0)
+	viper.Set("pagination.max_limit", 10)
+
+	var requests []*manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			requests = append(requests, searchRequest)
+			result := searchResponse("a", "b")
+			total := int32(5)
+			scroll := "scroll-token"
+			result.Hits.Total = &total
+			result.Scroll = &scroll
+			return result, nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	_, err := svc.SearchIdeas(context.Background(), SearchParams{Limit: 11})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	first, err := svc.SearchIdeas(context.Background(), SearchParams{Query: "rewilding_mode=露營", Limit: 2})
+	assert.NoError(t, err)
+	assert.True(t, first.HasMore)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// 查詢條件與游標不符
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Query: "rewilding_mode=登山", Cursor: first.NextCursor, Limit: 2})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	second, err := svc.SearchIdeas(context.Background(), SearchParams{Cursor: first.NextCursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.True(t, second.HasMore)
+	assert.Equal(t, "scroll-token", requests[len(requests)-1].Options["scroll"])
+
+	// 第三頁後已回傳 6 筆，超過總數 5 筆
+	third, err := svc.SearchIdeas(context.Background(), SearchParams{Cursor: second.NextCursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.False(t, third.HasMore)
+	assert.Empty(t, third.NextCursor)
+}
+
+func TestSearchIdeasPageMode(t *testing.T) {
+	defer viper.Set("pagination.max_matches", 0)
+	viper.Set("pagination.max_matches", 100)
+
+	var last *manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			last = searchRequest
+			result := searchResponse("a", "b", "c", "d", "e")
+			total := int32(230)
+			result.Hits.Total = &total
+			return result, nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	response, err := svc.SearchIdeas(context.Background(), SearchParams{Page: 5, PageSize: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), last.GetOffset())
+	assert.Equal(t, int32(5), last.GetLimit())
+	assert.Equal(t, int32(100), last.GetMaxMatches())
+	assert.NotContains(t, last.Options, "scroll")
+	assert.Equal(t, int32(5), response.Page)
+	// 總頁數以 max_matches 的 100 筆為上限
+	assert.Equal(t, int64(20), response.TotalPages)
+	assert.True(t, response.HasMore)
+	assert.Empty(t, response.NextCursor)
+
+	response, err = svc.SearchIdeas(context.Background(), SearchParams{Page: 20, PageSize: 5})
+	assert.NoError(t, err)
+	assert.False(t, response.HasMore)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Page: 21, PageSize: 5})
+	assert.ErrorIs(t, err, ErrPageOutOfRange)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Page: -1})
+	assert.ErrorIs(t, err, ErrInvalidPage)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Page: 1, Cursor: "cursor"})
+	assert.ErrorIs(t, err, ErrInvalidPage)
+}
+
+func TestSearchIdeasFields(t *testing.T) {
+	var last *manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			last = searchRequest
+			return searchResponse("森林露營"), nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	response, err := svc.SearchIdeas(context.Background(), SearchParams{Fields: []string{"id", "name", "tags"}})
+	assert.NoError(t, err)
+	source := last.Source.(*manticoresearch.SourceRules)
+	assert.Equal(t, []string{"name", "tags"}, source.Includes)
+	assert.Nil(t, source.Excludes)
+
+	body, err := json.Marshal(response)
+	assert.NoError(t, err)
+	var decoded struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, []map[string]interface{}{
+		{"id": float64(1), "name": "森林露營", "tags": []interface{}{""}},
+	}, decoded.Data)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Fields: []string{"-host_message"}})
+	assert.NoError(t, err)
+	source = last.Source.(*manticoresearch.SourceRules)
+	assert.Nil(t, source.Includes)
+	assert.Equal(t, []string{"host_message"}, source.Excludes)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Fields: []string{"id", "price"}})
+	assert.ErrorIs(t, err, ErrInvalidFields)
+}
+
+func TestSimilarIdeas(t *testing.T) {
+	var last *manticoresearch.SearchRequest
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if id == 3 {
+				return map[string]interface{}{"host_message": "歡迎參加", "tags": " , "}, nil
+			}
+			if id != 1 {
+				return nil, manticore.ErrDocumentNotFound
+			}
+			return map[string]interface{}{
+				"name":               "自行車地獄之旅",
+				"rewilding_name":     "河濱公園",
+				"rewilding_mode":     "露營",
+				"rewilding_location": "台北, 台灣",
+				"tags":               "新手,情侶",
+			}, nil
+		},
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			last = searchRequest
+			return searchResponse("河濱露營"), nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	response, err := svc.SimilarIdeas(context.Background(), 1, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.Total)
+	assert.Equal(t, defaultLimit, last.GetLimit())
+	assert.Equal(t, fieldWeights(), last.Options["field_weights"])
+
+	boolFilter := last.Query.Bool
+	// 排除來源 idea
+	assert.Equal(t, []*manticoresearch.QueryFilter{
+		{Equals: map[string]interface{}{"id": uint64(1)}},
+	}, boolFilter.MustNot)
+	// 兩個標籤、野放模式、地點與名稱關鍵詞，並只推薦未刪除、已發布且在顯示期間內的 idea
+	assert.Len(t, boolFilter.Must, 5)
+	assert.Len(t, boolFilter.Must[0].Bool.Should, 5)
+	assert.Equal(t, map[string]interface{}{"deleted_at": 0}, boolFilter.Must[1].Equals)
+	assert.Equal(t, map[string]interface{}{"status": model.StatusPublished}, boolFilter.Must[2].Equals)
+	assert.Contains(t, boolFilter.Must[3].Range, "publish_at")
+
+	_, err = svc.SimilarIdeas(context.Background(), 1, 0, true)
+	assert.NoError(t, err)
+	assert.Len(t, last.Query.Bool.Must, 6)
+	assert.Equal(t, map[string]interface{}{"rewilding_location": "台北, 台灣"}, last.Query.Bool.Must[1].Equals)
+
+	_, err = svc.SimilarIdeas(context.Background(), 2, 0, false)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+
+	// 沒有可比對的條件時不搜尋，回傳空的結果
+	last = nil
+	response, err = svc.SimilarIdeas(context.Background(), 3, 0, false)
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+	assert.Empty(t, response.Data)
+	assert.NotNil(t, response.Data)
+	assert.Zero(t, response.Total)
+}
+
+func TestCreateIdeaEmbedding(t *testing.T) {
+	var created map[string]interface{}
+	client := &mockManticore{
+		createFunc: func(index string, data map[string]interface{}) (int64, error) {
+			created = data
+			return 1, nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	_, err := svc.CreateIdea(context.Background(), &model.IdeaData{ID: 1, Name: "親子登山", Tags: "新手,親子"})
+	assert.NoError(t, err)
+	assert.Len(t, created["embedding"], model.EmbeddingDims)
+}
+
+func TestSemanticSearch(t *testing.T) {
+	var requests []*manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			requests = append(requests, searchRequest)
+			if searchRequest.Knn != nil {
+				// KNN 結果: id 1, 2, 3
+				return searchResponse("a", "b", "c"), nil
+			}
+			// BM25 結果: id 3, 1
+			result := searchResponse("c", "a")
+			result.Hits.Hits[0]["_id"] = float64(3)
+			result.Hits.Hits[1]["_id"] = float64(1)
+			return result, nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	response, err := svc.SearchIdeas(context.Background(), SearchParams{Query: "rewilding_mode=露營", Semantic: "帶小孩去山上", Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, requests, 1)
+	knn := requests[0].Knn
+	assert.Equal(t, "embedding", knn.Field)
+	assert.Equal(t, int32(2), knn.K)
+	assert.Len(t, knn.QueryVector, model.EmbeddingDims)
+	assert.NotNil(t, knn.Filter)
+	assert.Nil(t, requests[0].Query)
+	assert.Len(t, response.Data, 2)
+	assert.False(t, response.HasMore)
+
+	requests = nil
+	response, err = svc.SearchIdeas(context.Background(), SearchParams{Semantic: "帶小孩去山上", Hybrid: true, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, int32(6), requests[0].Knn.K)
+	assert.Equal(t, "帶小孩去山上", keywordOf(requests[1]))
+	// 兩種搜尋都排在前面的 id 1 與 3 勝出
+	assert.Equal(t, uint64(1), response.Data[0].ID)
+	assert.Equal(t, uint64(3), response.Data[1].ID)
+	assert.Equal(t, int64(3), response.Total)
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Semantic: "帶小孩去山上", Page: 1})
+	assert.ErrorIs(t, err, ErrInvalidPage)
+}
+
+// fakeIndex 以簡化的規則在記憶體中執行搜尋請求，用於驗證查詢條件對結果與排序的影響：
+// Equals 與 In 比對屬性、Range 比對數值、Match 以子字串比對、MatchAll 永遠成立，_score 為成立的 Match 條件數量
+type fakeIndex []map[string]interface{}
+
+func (idx fakeIndex) search(searchRequest *manticoresearch.SearchRequest) *manticoresearch.SearchResponse {
+	type scored struct {
+		doc   map[string]interface{}
+		score int
+	}
+	results := make([]scored, 0)
+	filter := &manticoresearch.QueryFilter{Bool: searchRequest.Query.Bool}
+	for _, doc := range idx {
+		if ok, score := evaluate(filter, doc); ok {
+			results = append(results, scored{doc, score})
+		}
+	}
+
+	byScore := false
+	if sorts, ok := searchRequest.Sort.([]map[string]string); ok && len(sorts) > 0 {
+		_, byScore = sorts[0]["_score"]
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if byScore && results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].doc["id"].(int) < results[j].doc["id"].(int)
+	})
+
+	hits := make([]map[string]interface{}, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, map[string]interface{}{
+			"_id":     float64(result.doc["id"].(int)),
+			"_source": result.doc,
+		})
+	}
+	total := int32(len(hits))
+	return &manticoresearch.SearchResponse{
+		Hits: &manticoresearch.SearchResponseHits{Total: &total, Hits: hits},
+	}
+}
+
+func evaluate(filter *manticoresearch.QueryFilter, doc map[string]interface{}) (bool, int) {
+	switch {
+	case filter.Bool != nil:
+		score := 0
+		for i := range filter.Bool.Must {
+			ok, s := evaluate(&filter.Bool.Must[i], doc)
+			if !ok {
+				return false, 0
+			}
+			score += s
+		}
+		if len(filter.Bool.Should) == 0 {
+			return true, score
+		}
+		matched := false
+		for _, should := range filter.Bool.Should {
+			if ok, s := evaluate(should, doc); ok {
+				matched = true
+				score += s
+			}
+		}
+		return matched, score
+	case filter.Equals != nil:
+		for field, value := range filter.Equals.(map[string]interface{}) {
+			// 與 Manticore 相同，未設定的數值屬性視為 0
+			actual, ok := doc[field]
+			if !ok {
+				actual = 0
+			}
+			if fmt.Sprint(actual) != fmt.Sprint(value) {
+				return false, 0
+			}
+		}
+		return true, 0
+	case filter.In != nil:
+		for field, values := range filter.In {
+			found := false
+			for _, value := range values.([]string) {
+				found = found || fmt.Sprint(doc[field]) == value
+			}
+			if !found {
+				return false, 0
+			}
+		}
+		return true, 0
+	case filter.Range != nil:
+		for field, bounds := range filter.Range {
+			actual := number(doc[field])
+			for op, bound := range bounds.(map[string]interface{}) {
+				limit := number(bound)
+				if op == "gt" && actual <= limit || op == "gte" && actual < limit ||
+					op == "lt" && actual >= limit || op == "lte" && actual > limit {
+					return false, 0
+				}
+			}
+		}
+		return true, 0
+	case filter.Match != nil:
+		for field, value := range filter.Match.(map[string]interface{}) {
+			query := value.(map[string]interface{})["query"].(string)
+			if !strings.Contains(fmt.Sprint(doc[field]), query) {
+				return false, 0
+			}
+		}
+		return true, 1
+	case filter.MatchAll != nil:
+		return true, 0
+	}
+	return false, 0
+}
+
+// number 將文件或條件中的數值轉為 float64，未設定的屬性視為 0
+func number(value interface{}) float64 {
+	if value == nil {
+		return 0
+	}
+	parsed, _ := strconv.ParseFloat(fmt.Sprint(value), 64)
+	return parsed
+}
+
+func TestSearchIdeasPreferences(t *testing.T) {
+	defer viper.Set("personalization.profiles", nil)
+	viper.Set("personalization.profiles", map[string]interface{}{
+		"user-1": map[string]interface{}{"prefer_modes": []string{"登山"}},
+	})
+
+	index := fakeIndex{
+		{"id": 1, "rewilding_mode": "露營", "rewilding_location": "台北", "tags": "新手", "status": "published"},
+		{"id": 2, "rewilding_mode": "登山", "rewilding_location": "台北", "tags": "親子", "status": "published"},
+		{"id": 3, "rewilding_mode": "露營", "rewilding_location": "台北", "tags": "親子", "status": "published"},
+		{"id": 4, "rewilding_mode": "登山", "rewilding_location": "台中", "tags": "親子", "status": "published"},
+		// 草稿不會出現在公開搜尋中
+		{"id": 5, "rewilding_mode": "登山", "rewilding_location": "台北", "tags": "親子", "status": "draft"},
+	}
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			return index.search(searchRequest), nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	ids := func(response *model.SearchResponse) []uint64 {
+		result := make([]uint64, 0, len(response.Data))
+		for _, idea := range response.Data {
+			result = append(result, idea.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		params SearchParams
+		want   []uint64
+	}{
+		{
+			name:   "no preferences",
+			params: SearchParams{Query: "rewilding_location=台北"},
+			want:   []uint64{1, 2, 3},
+		},
+		{
+			name:   "prefer modes",
+			params: SearchParams{Query: "rewilding_location=台北", Prefer: &UserProfile{PreferModes: []string{"登山"}}},
+			want:   []uint64{2, 1, 3},
+		},
+		{
+			name:   "prefer tags",
+			params: SearchParams{Query: "rewilding_location=台北", Prefer: &UserProfile{PreferTags: []string{"親子"}}},
+			want:   []uint64{2, 3, 1},
+		},
+		{
+			name:   "user profile merged with explicit preferences",
+			params: SearchParams{Query: "rewilding_location=台北", UserID: "user-1", Prefer: &UserProfile{PreferTags: []string{"新手"}}},
+			want:   []uint64{1, 2, 3},
+		},
+		{
+			name:   "user profile",
+			params: SearchParams{Query: "rewilding_location=台北", UserID: "user-1"},
+			want:   []uint64{2, 1, 3},
+		},
+		{
+			name:   "unknown user",
+			params: SearchParams{Query: "rewilding_location=台北", UserID: "user-2"},
+			want:   []uint64{1, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := svc.SearchIdeas(context.Background(), test.params)
+			assert.NoError(t, err)
+			// 排序依偏好改變，但結果集合不變
+			assert.Equal(t, test.want, ids(response))
+			assert.ElementsMatch(t, []uint64{1, 2, 3}, ids(response))
+		})
+	}
+}
+
+func TestSearchIdeasRanking(t *testing.T) {
+	defer viper.Set("ranking.profiles", nil)
+	viper.Set("ranking.profiles", map[string]interface{}{
+		"booked": map[string]interface{}{"expression": "booking_count"},
+	})
+
+	var last *manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			last = searchRequest
+			result := searchResponse("a", "b")
+			total := int32(4)
+			scroll := "scroll-token"
+			result.Hits.Total = &total
+			result.Scroll = &scroll
+			return result, nil
+		},
+	}
+	svc := NewIdeaService(client)
+
+	response, err := svc.SearchIdeas(context.Background(), SearchParams{Query: "keyword=露營", Rank: "popular"})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRankingProfiles["popular"].Expression, last.Expressions[rankScore])
+	assert.Equal(t, "proximity_bm25", last.Options["ranker"])
+	assert.Equal(t, []map[string]string{{rankScore: "desc"}, {"id": "asc"}}, last.Sort)
+
+	// 續頁沿用游標內的排序方式
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Cursor: response.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRankingProfiles["popular"].Expression, last.Expressions[rankScore])
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Rank: "booked"})
+	assert.NoError(t, err)
+	assert.Equal(t, "booking_count", last.Expressions[rankScore])
+	assert.NotContains(t, last.Options, "ranker")
+
+	_, err = svc.SearchIdeas(context.Background(), SearchParams{Rank: "unknown"})
+	assert.ErrorIs(t, err, ErrInvalidRank)
+}
+
+func TestReplaceIdeaKeepsSignals(t *testing.T) {
+	var replaced map[string]interface{}
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"name":          "舊名稱",
+				"created_at":    float64(100),
+				"updated_at":    float64(200),
+				"view_count":    float64(30),
+				"booking_count": float64(4),
+			}, nil
+		},
+		replaceFunc: func(index string, id int64, data map[string]interface{}) error {
+			replaced = data
+			return nil
+		},
+	}
+	svc := NewIdeaService(client)
+	svc.now = func() time.Time { return time.Unix(300, 0) }
+
+	err := svc.ReplaceIdea(context.Background(), 1, &model.IdeaData{ID: 1, Name: "新名稱"})
+	assert.NoError(t, err)
+	assert.Equal(t, "新名稱", replaced["name"])
+	assert.Equal(t, int64(100), replaced["created_at"])
+	assert.Equal(t, int64(300), replaced["updated_at"])
+	assert.Equal(t, int64(30), replaced["view_count"])
+	assert.Equal(t, int64(4), replaced["booking_count"])
+}
+
+func TestIdeaVersionConflict(t *testing.T) {
+	docs := map[int64]map[string]interface{}{}
+	client := &mockManticore{
+		createFunc: func(index string, data map[string]interface{}) (int64, error) {
+			docs[1] = data
+			return 1, nil
+		},
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if doc, ok := docs[id]; ok {
+				return doc, nil
+			}
+			return nil, manticore.ErrDocumentNotFound
+		},
+		replaceFunc: func(index string, id int64, data map[string]interface{}) error {
+			docs[id] = data
+			return nil
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			for key, value := range data {
+				docs[id][key] = value
+			}
+			return nil
+		},
+	}
+	svc := NewIdeaService(client)
+	ctx := context.Background()
+
+	_, err := svc.CreateIdea(ctx, &model.IdeaData{Name: "初版"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), docs[1]["version"])
+
+	// 兩位編輯者都讀取了版本 1，後儲存的一方收到衝突
+	first := &model.IdeaData{ID: 1, Name: "編輯者 A", Version: 1}
+	assert.NoError(t, svc.ReplaceIdea(ctx, 1, first))
+	assert.Equal(t, int64(2), first.Version)
+	assert.Equal(t, int64(2), docs[1]["version"])
+
+	err = svc.ReplaceIdea(ctx, 1, &model.IdeaData{ID: 1, Name: "編輯者 B", Version: 1})
+	var conflict *ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, int64(1), conflict.Expected)
+	assert.Equal(t, int64(2), conflict.Current)
+	assert.Equal(t, "編輯者 A", docs[1]["name"])
+
+	// 未帶版本時不檢查
+	assert.NoError(t, svc.ReplaceIdea(ctx, 1, &model.IdeaData{ID: 1, Name: "同步"}))
+	assert.Equal(t, int64(3), docs[1]["version"])
+
+	assert.ErrorIs(t, svc.DeleteIdea(ctx, 1, 2), ErrVersionConflict)
+	assert.Equal(t, int64(0), docs[1]["deleted_at"])
+	assert.NoError(t, svc.DeleteIdea(ctx, 1, 3))
+	assert.Equal(t, int64(4), docs[1]["version"])
+
+	// 資源回收筒中的 idea 需先還原才能更新
+	err = svc.ReplaceIdea(ctx, 1, &model.IdeaData{ID: 1, Name: "編輯者 B", Version: 4})
+	assert.ErrorIs(t, err, ErrIdeaInTrash)
+	assert.ErrorIs(t, svc.DeleteIdea(ctx, 1, 0), ErrIdeaNotFound)
+	assert.ErrorIs(t, svc.DeleteIdea(ctx, 2, 0), ErrIdeaNotFound)
+	// 不存在或已刪除的 idea 帶版本刪除時回傳 ErrIdeaNotFound，而不是版本衝突
+	err = svc.DeleteIdea(ctx, 1, 4)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+	assert.NotErrorIs(t, err, ErrVersionConflict)
+	assert.ErrorIs(t, svc.DeleteIdea(ctx, 2, 1), ErrIdeaNotFound)
+}
+
+func TestTrash(t *testing.T) {
+	now := time.Now()
+	docs := map[int64]map[string]interface{}{
+		1: {"id": int64(1), "name": "河濱露營", "version": int64(1), "deleted_at": int64(0), "owner_id": "host-1"},
+		2: {"id": int64(2), "name": "溪谷溯溪", "version": int64(1), "deleted_at": int64(0), "owner_id": "host-1"},
+		3: {"id": int64(3), "name": "古道健行", "version": int64(2), "deleted_at": now.Add(-40 * 24 * time.Hour).Unix(), "owner_id": "host-2"},
+	}
+	var purged []int64
+	// afterSearch 不為 nil 時在搜尋後執行一次，模擬搜尋與刪除之間完成的其他請求
+	var afterSearch func()
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if doc, ok := docs[id]; ok {
+				return doc, nil
+			}
+			return nil, manticore.ErrDocumentNotFound
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			for key, value := range data {
+				docs[id][key] = value
+			}
+			return nil
+		},
+		deleteFunc: func(index string, id int64) error {
+			purged = append(purged, id)
+			delete(docs, id)
+			return nil
+		},
+		// 依 deleted_at 的範圍條件與 owner_id 列出資源回收筒，由新到舊排序
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			must := searchRequest.Query.Bool.Must
+			deletedAt := must[0].Range["deleted_at"].(map[string]interface{})
+			ids := make([]int64, 0, len(docs))
+			for id, doc := range docs {
+				value := doc["deleted_at"].(int64)
+				if before, ok := deletedAt["lt"].(int64); value == 0 || ok && value >= before {
+					continue
+				}
+				if len(must) > 1 && must[1].Equals.(map[string]interface{})["owner_id"] != doc["owner_id"] {
+					continue
+				}
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				return docs[ids[i]]["deleted_at"].(int64) > docs[ids[j]]["deleted_at"].(int64)
+			})
+			hits := make([]map[string]interface{}, 0, len(ids))
+			for _, id := range ids {
+				hits = append(hits, map[string]interface{}{"_id": float64(id), "_source": docs[id]})
+			}
+			total := int32(len(hits))
+			if afterSearch != nil {
+				run := afterSearch
+				afterSearch = nil
+				run()
+			}
+			return &manticoresearch.SearchResponse{
+				Hits: &manticoresearch.SearchResponseHits{Total: &total, Hits: hits},
+			}, nil
+		},
+	}
+	svc := NewIdeaService(client)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	assert.NoError(t, svc.DeleteIdea(ctx, 1, 0))
+	_, err := svc.GetIdea(ctx, 1)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+
+	response, err := svc.TrashIdeas(ctx, "", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), response.Total)
+	assert.Equal(t, uint64(1), response.Data[0].ID)
+	assert.Equal(t, now.Unix(), response.Data[0].DeletedAt)
+	// 只列出指定使用者擁有的 idea
+	response, err = svc.TrashIdeas(ctx, "host-2", 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.Total)
+	assert.Equal(t, uint64(3), response.Data[0].ID)
+	trashed, err := svc.TrashedIdea(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Unix(), trashed.Deleted_at)
+
+	restored, err := svc.RestoreIdea(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), restored.Deleted_at)
+	assert.Equal(t, int64(3), restored.Version)
+	assert.Equal(t, int64(0), docs[1]["deleted_at"])
+	_, err = svc.GetIdea(ctx, 1)
+	assert.NoError(t, err)
+	_, err = svc.TrashedIdea(ctx, 1)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+
+	// 未刪除的 idea 還原時原樣回傳
+	restored, err = svc.RestoreIdea(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), restored.Version)
+	_, err = svc.RestoreIdea(ctx, 4)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+
+	// 只永久刪除超過保留期限的 idea
+	assert.NoError(t, svc.DeleteIdea(ctx, 2, 0))
+	count, err := svc.PurgeTrash(ctx, 30*24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []int64{3}, purged)
+	assert.Contains(t, docs, int64(2))
+
+	// 搜尋之後、刪除之前被還原的 idea 不會被永久刪除
+	docs[2]["deleted_at"] = now.Add(-40 * 24 * time.Hour).Unix()
+	afterSearch = func() {
+		_, err := svc.RestoreIdea(ctx, 2)
+		assert.NoError(t, err)
+	}
+	count, err = svc.PurgeTrash(ctx, 30*24*time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Equal(t, []int64{3}, purged)
+	assert.Equal(t, int64(0), docs[2]["deleted_at"])
+}
+
+func TestIdeaStatus(t *testing.T) {
+	docs := map[int64]map[string]interface{}{}
+	client := &mockManticore{
+		createFunc: func(index string, data map[string]interface{}) (int64, error) {
+			docs[1] = data
+			return 1, nil
+		},
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if doc, ok := docs[id]; ok {
+				return doc, nil
+			}
+			return nil, manticore.ErrDocumentNotFound
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			for key, value := range data {
+				docs[id][key] = value
+			}
+			return nil
+		},
+	}
+	svc := NewIdeaService(client)
+	ctx := context.Background()
+
+	_, err := svc.CreateIdea(ctx, &model.IdeaData{Name: "草稿", Status: model.StatusPublished})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusDraft, docs[1]["status"])
+
+	// 草稿需先送審才能發布
+	_, err = svc.TransitionIdea(ctx, 1, model.StatusPublished, 0)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	_, err = svc.TransitionIdea(ctx, 1, "deleted", 0)
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+
+	idea, err := svc.TransitionIdea(ctx, 1, model.StatusPendingReview, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusPendingReview, idea.Status)
+	assert.Equal(t, int64(2), idea.Version)
+	_, err = svc.TransitionIdea(ctx, 1, model.StatusPublished, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = svc.TransitionIdea(ctx, 1, model.StatusPublished, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusPublished, docs[1]["status"])
+
+	// 更新內容時保留狀態
+	assert.NoError(t, svc.ReplaceIdea(ctx, 1, &model.IdeaData{ID: 1, Name: "已發布"}))
+	assert.Equal(t, model.StatusPublished, docs[1]["status"])
+	_, err = svc.TransitionIdea(ctx, 2, model.StatusPendingReview, 0)
+	assert.ErrorIs(t, err, ErrIdeaNotFound)
+}
+
+func TestSearchIdeasStatuses(t *testing.T) {
+	index := fakeIndex{
+		{"id": 1, "status": model.StatusDraft},
+		{"id": 2, "status": model.StatusPendingReview},
+		{"id": 3, "status": model.StatusPublished},
+		{"id": 4, "status": model.StatusArchived},
+	}
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			return index.search(searchRequest), nil
+		},
+	}
+	svc := NewIdeaService(client)
+	ctx := context.Background()
+
+	ids := func(params SearchParams) []uint64 {
+		response, err := svc.SearchIdeas(ctx, params)
+		assert.NoError(t, err)
+		result := make([]uint64, 0, len(response.Data))
+		for _, idea := range response.Data {
+			result = append(result, idea.ID)
+		}
+		return result
+	}
+	assert.Equal(t, []uint64{3}, ids(SearchParams{}))
+	// 公開搜尋無法以查詢字串指定狀態
+	assert.Equal(t, []uint64{3}, ids(SearchParams{Query: "status=draft"}))
+	assert.Equal(t, []uint64{1, 2}, ids(SearchParams{Statuses: []string{model.StatusDraft, model.StatusPendingReview}}))
+	assert.Equal(t, []uint64{4}, ids(SearchParams{Statuses: []string{model.StatusArchived}}))
+
+	_, err := svc.SearchIdeas(ctx, SearchParams{Statuses: []string{"deleted"}})
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+}
+
+func TestSearchIdeasStatusesPagination(t *testing.T) {
+	var requests []*manticoresearch.SearchRequest
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			requests = append(requests, searchRequest)
+			result := searchResponse("a", "b")
+			total := int32(5)
+			scroll := "scroll-token"
+			result.Hits.Total = &total
+			result.Scroll = &scroll
+			return result, nil
+		},
+	}
+	svc := NewIdeaService(client)
+	ctx := context.Background()
+	statuses := []string{model.StatusDraft, model.StatusArchived}
+
+	first, err := svc.SearchIdeas(ctx, SearchParams{Statuses: statuses, Limit: 2})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// 管理者搜尋以相同的狀態續頁
+	second, err := svc.SearchIdeas(ctx, SearchParams{Statuses: statuses, Cursor: first.NextCursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.True(t, second.HasMore)
+	assert.Equal(t, "scroll-token", requests[len(requests)-1].Options["scroll"])
+	third, err := svc.SearchIdeas(ctx, SearchParams{Statuses: statuses, Cursor: second.NextCursor, Limit: 2})
+	assert.NoError(t, err)
+	assert.False(t, third.HasMore)
+
+	// 管理者搜尋的游標不能用於公開搜尋或其他狀態
+	_, err = svc.SearchIdeas(ctx, SearchParams{Cursor: first.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = svc.SearchIdeas(ctx, SearchParams{Statuses: []string{model.StatusDraft}, Cursor: first.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestSearchIdeasTimeWindow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	index := fakeIndex{
+		{"id": 1, "status": model.StatusPublished, "tags": "新手"},
+		{"id": 2, "status": model.StatusPublished, "tags": "期間限定", "publish_at": now.Add(-time.Hour).Unix(), "expire_at": now.Add(time.Hour).Unix()},
+		// 尚未開始與已到期的 idea
+		{"id": 3, "status": model.StatusPublished, "tags": "期間限定", "publish_at": now.Add(time.Hour).Unix()},
+		{"id": 4, "status": model.StatusPublished, "tags": "期間限定", "expire_at": now.Unix()},
+	}
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			return index.search(searchRequest), nil
+		},
+	}
+	svc := NewIdeaService(client)
+	svc.now = func() time.Time { return now }
+
+	ids := func(params SearchParams) []uint64 {
+		response, err := svc.SearchIdeas(context.Background(), params)
+		assert.NoError(t, err)
+		result := make([]uint64, 0, len(response.Data))
+		for _, idea := range response.Data {
+			result = append(result, idea.ID)
+		}
+		return result
+	}
+	assert.Equal(t, []uint64{1, 2}, ids(SearchParams{}))
+	assert.Equal(t, []uint64{2}, ids(SearchParams{Query: "tags=期間限定"}))
+	// 管理者搜尋不受顯示期間限制
+	assert.Equal(t, []uint64{1, 2, 3, 4}, ids(SearchParams{Statuses: []string{model.StatusPublished}}))
+}
+
+// eventSink 記錄收到的 idea 事件
+type eventSink []interface{}
+
+func (s *eventSink) Append(records ...interface{}) error {
+	*s = append(*s, records...)
+	return nil
+}
+
+func TestSweepSchedule(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	docs := map[int64]map[string]interface{}{
+		1: {"id": 1, "status": model.StatusPublished, "version": 1, "expire_at": now.Add(-time.Minute).Unix()},
+		2: {"id": 2, "status": model.StatusPublished, "version": 1, "expire_at": now.Add(time.Hour).Unix()},
+		3: {"id": 3, "status": model.StatusPublished, "version": 1, "publish_at": now.Add(-time.Minute).Unix()},
+		4: {"id": 4, "status": model.StatusPublished, "version": 1, "publish_at": now.Add(-time.Hour).Unix()},
+		// 已下架的 idea 不再處理
+		5: {"id": 5, "status": model.StatusArchived, "version": 1, "expire_at": now.Add(-time.Hour).Unix()},
+	}
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if doc, ok := docs[id]; ok {
+				return doc, nil
+			}
+			return nil, manticore.ErrDocumentNotFound
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			for key, value := range data {
+				docs[id][key] = value
+			}
+			return nil
+		},
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			index := make(fakeIndex, 0, len(docs))
+			for id := int64(1); id <= int64(len(docs)); id++ {
+				index = append(index, docs[id])
+			}
+			return index.search(searchRequest), nil
+		},
+	}
+	sink := &eventSink{}
+	version := NewLocalIndexVersion()
+	svc := NewIdeaService(client, WithIdeaEvents(sink), WithIndexVersion(version))
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+	before, _, err := version.Current(ctx)
+	assert.NoError(t, err)
+
+	expired, err := svc.SweepSchedule(ctx, now.Add(-10*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, model.StatusArchived, docs[1]["status"])
+	assert.Equal(t, int64(2), docs[1]["version"])
+	assert.Equal(t, model.StatusPublished, docs[2]["status"])
+	assert.Equal(t, eventSink{
+		model.IdeaEvent{Type: model.IdeaEventPublished, IdeaID: 3, Timestamp: now.Unix()},
+		model.IdeaEvent{Type: model.IdeaEventExpired, IdeaID: 1, Timestamp: now.Unix()},
+	}, *sink)
+	after, _, err := version.Current(ctx)
+	assert.NoError(t, err)
+	assert.NotEqual(t, before, after)
+
+	// 沒有新的排程時不發送事件
+	*sink = nil
+	expired, err = svc.SweepSchedule(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+	assert.Empty(t, *sink)
+}
+
+func TestRecordAndRollupEvents(t *testing.T) {
+	store, err := eventlog.NewStore(filepath.Join(t.TempDir(), "events.log"), 100, time.Hour)
+	assert.NoError(t, err)
+
+	sources := map[int64]map[string]interface{}{
+		1: {"view_count": float64(10), "impression_count": float64(100)},
+		2: {"bookmark_count": float64(1)},
+	}
+	updates := make(map[int64]map[string]interface{})
+	failUpdate := true
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			if source, ok := sources[id]; ok {
+				return source, nil
+			}
+			return nil, manticore.ErrDocumentNotFound
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			if failUpdate {
+				return fmt.Errorf("connection refused")
+			}
+			updates[id] = data
+			return nil
+		},
+	}
+	svc := NewEventService(client, store)
+	svc.now = func() time.Time { return time.Unix(500, 0) }
+
+	_, err = svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{{Type: "purchase", IdeaID: 1, Position: 1}})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+	_, err = svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{{Type: model.SearchEventClick, IdeaID: 1}})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+
+	accepted, err := svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{
+		{Type: model.SearchEventImpression, Query: "露營", IdeaID: 1, Position: 1},
+		{Type: model.SearchEventImpression, Query: "露營", IdeaID: 2, Position: 2},
+		{Type: model.SearchEventImpression, Query: "露營", IdeaID: 3, Position: 3},
+		{Type: model.SearchEventClick, Query: "露營", IdeaID: 1, Position: 1},
+		{Type: model.SearchEventClick, Query: "露營", IdeaID: 1, Position: 1},
+		{Type: model.SearchEventBookmark, Query: "露營", IdeaID: 2, Position: 2},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, accepted)
+	accepted, err = svc.RecordEvents("user:user-1", []model.SearchEvent{{Type: model.SearchEventClick, Query: "露營", IdeaID: 1, Position: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+
+	// 尚未寫入檔案的事件不會被彙總
+	assert.NoError(t, svc.Rollup(context.Background()))
+	assert.Empty(t, updates)
+
+	// 更新失敗時不推進彙總位置
+	assert.NoError(t, store.Flush())
+	assert.Error(t, svc.Rollup(context.Background()))
+	failUpdate = false
+	assert.NoError(t, svc.Rollup(context.Background()))
+	assert.Equal(t, map[int64]map[string]interface{}{
+		1: {"view_count": int64(12), "impression_count": int64(101)},
+		2: {"impression_count": int64(1), "bookmark_count": int64(2)},
+	}, updates)
+
+	// 已彙總的事件不會重複計算
+	updates = make(map[int64]map[string]interface{})
+	assert.NoError(t, svc.Rollup(context.Background()))
+	assert.Empty(t, updates)
+
+	_, err = svc.RecordEvents("ip:192.0.2.2", []model.SearchEvent{{Type: model.SearchEventClick, IdeaID: 2, Position: 1}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Flush())
+	assert.NoError(t, svc.Rollup(context.Background()))
+	assert.Equal(t, map[int64]map[string]interface{}{2: {"view_count": int64(1)}}, updates)
+
+	// 與 ReplaceIdea 共用 lockIdea，idea 寫入中時等待寫入完成才累加
+	_, err = svc.RecordEvents("ip:192.0.2.3", []model.SearchEvent{{Type: model.SearchEventClick, IdeaID: 2, Position: 1}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Flush())
+	unlock := lockIdea(2)
+	done := make(chan error, 1)
+	go func() { done <- svc.Rollup(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("rollup should wait for the idea lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	assert.NoError(t, <-done)
+}
+
+func TestRecordEventsDedupe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	store, err := eventlog.NewStore(path, 100, time.Hour)
+	assert.NoError(t, err)
+	svc := NewEventService(&mockManticore{}, store, WithDedupeWindow(time.Minute))
+	now := time.Unix(1000, 0)
+	svc.now = func() time.Time { return now }
+
+	click := model.SearchEvent{Type: model.SearchEventClick, Query: "露營", IdeaID: 1, Position: 1}
+	accepted, err := svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{click})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+
+	// 期間內重送或更換查詢字串仍視為同一個事件
+	now = now.Add(30 * time.Second)
+	replay := click
+	replay.Query = "登山"
+	accepted, err = svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{click, replay})
+	assert.NoError(t, err)
+	assert.Zero(t, accepted)
+
+	// 超過期間後重新計算
+	now = now.Add(time.Minute)
+	accepted, err = svc.RecordEvents("ip:192.0.2.1", []model.SearchEvent{click})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+	assert.Len(t, svc.seen, 1)
+
+	// 事件時間一律為伺服器收到的時間
+	assert.NoError(t, store.Flush())
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+	var event model.SearchEvent
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, now.Unix(), event.Timestamp)
+}
+
+func TestRollupInvalidatesSearch(t *testing.T) {
+	store, err := eventlog.NewStore(filepath.Join(t.TempDir(), "events.log"), 100, time.Hour)
+	assert.NoError(t, err)
+	searches := 0
+	client := &mockManticore{
+		readFunc: func(index string, id int64) (map[string]interface{}, error) {
+			return map[string]interface{}{"view_count": float64(1)}, nil
+		},
+		updateFunc: func(index string, id int64, data map[string]interface{}) error {
+			return nil
+		},
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			searches++
+			return searchResponse("露營 A", "露營 B"), nil
+		},
+	}
+	backend, err := cache.NewLRU(10)
+	assert.NoError(t, err)
+	searchCache := NewSearchCache(backend, time.Minute)
+	version := NewLocalIndexVersion()
+	ideas := NewIdeaService(client, WithSearchCache(searchCache), WithIndexVersion(version))
+	events := NewEventService(client, store, WithRollupInvalidation(searchCache, version))
+	ctx := context.Background()
+
+	_, err = ideas.SearchIdeas(ctx, SearchParams{Query: "keyword=露營", Rank: "popular"})
+	assert.NoError(t, err)
+	before, _, err := version.Current(ctx)
+	assert.NoError(t, err)
+
+	// 沒有新的事件時不清除快取
+	assert.NoError(t, events.Rollup(ctx))
+	_, err = ideas.SearchIdeas(ctx, SearchParams{Query: "keyword=露營", Rank: "popular"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, searches)
+
+	// 熱門度更新後清除快取並遞增索引版本，熱門排序與 ETag 才會反映新的熱門度
+	_, err = events.RecordEvents("ip:192.0.2.1", []model.SearchEvent{{Type: model.SearchEventClick, IdeaID: 1, Position: 1}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Flush())
+	assert.NoError(t, events.Rollup(ctx))
+	_, err = ideas.SearchIdeas(ctx, SearchParams{Query: "keyword=露營", Rank: "popular"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, searches)
+	after, _, err := version.Current(ctx)
+	assert.NoError(t, err)
+	assert.NotEqual(t, before, after)
+}
+
+func TestSearchAnalytics(t *testing.T) {
+	analytics := NewSearchAnalytics()
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			if keywordOf(searchRequest) == "冰河" {
+				return searchResponse(), nil
+			}
+			return searchResponse("露營 A", "露營 B"), nil
+		},
+	}
+	svc := NewIdeaService(client, WithSearchRecorder(analytics))
+	clock := time.Unix(1000, 0)
+	svc.now = func() time.Time {
+		clock = clock.Add(10 * time.Millisecond)
+		return clock
+	}
+
+	for _, query := range []string{
+		"keyword=露營",
+		"keyword=%20露營%20&rewilding_mode=野營",
+		"keyword=露營&rewilding_mode=野營",
+		"keyword=冰河",
+		"",
+	} {
+		response, err := svc.SearchIdeas(context.Background(), SearchParams{Query: query})
+		assert.NoError(t, err)
+		// 續頁不重複記錄
+		if response.NextCursor != "" {
+			_, err = svc.SearchIdeas(context.Background(), SearchParams{Cursor: response.NextCursor})
+			assert.NoError(t, err)
+		}
+	}
+	// 失敗的搜尋不記錄
+	_, err := svc.SearchIdeas(context.Background(), SearchParams{Rank: "unknown"})
+	assert.ErrorIs(t, err, ErrInvalidRank)
+
+	analytics.now = func() time.Time { return time.Unix(1001, 0) }
+	stats := analytics.Stats(time.Hour, 0)
+	assert.Equal(t, 5, stats.Searches)
+	assert.Equal(t, []QueryCount{
+		{Query: "露營", Filters: "rewilding_mode=%E9%87%8E%E7%87%9F", Count: 2},
+		{Query: "冰河", Count: 1},
+		{Query: "露營", Count: 1},
+	}, stats.TopQueries)
+	assert.Equal(t, []QueryCount{{Query: "冰河", Count: 1}}, stats.ZeroResultQueries)
+	// 每次讀取時間前進 10ms，搜尋期間另外為公開搜尋的顯示期間讀取一次
+	assert.Equal(t, float64(20), stats.LatencyP50Ms)
+	assert.Equal(t, float64(20), stats.LatencyP95Ms)
+
+	assert.Equal(t, "1h0m0s", stats.Window)
+	assert.False(t, stats.Truncated)
+
+	// 以 ETag 判斷未變更的搜尋也計入，結果未知時不視為沒有結果
+	svc.RecordNotModified(SearchParams{Query: "keyword=冰河"}, clock)
+	svc.RecordNotModified(SearchParams{Query: "keyword=冰河", Page: 2}, clock)
+	stats = analytics.Stats(time.Hour, 0)
+	assert.Equal(t, 6, stats.Searches)
+	assert.Equal(t, []QueryCount{{Query: "冰河", Count: 1}}, stats.ZeroResultQueries)
+
+	// 超出統計期間的紀錄不計入
+	analytics.now = func() time.Time { return time.Unix(5000, 0) }
+	stats = analytics.Stats(time.Hour, 0)
+	assert.Equal(t, 0, stats.Searches)
+	assert.Empty(t, stats.TopQueries)
+}
+
+func TestSearchAnalyticsCapacity(t *testing.T) {
+	viper.Set("analytics.capacity", 3)
+	defer viper.Set("analytics.capacity", nil)
+
+	analytics := NewSearchAnalytics()
+	analytics.now = func() time.Time { return time.Unix(100, 0) }
+	for i := 1; i <= 5; i++ {
+		analytics.RecordSearch(SearchRecord{
+			Query:   fmt.Sprintf("q%d", i),
+			Latency: time.Duration(i) * time.Millisecond,
+			At:      time.Unix(int64(90+i), 0),
+		})
+	}
+
+	// 較早的紀錄已被覆蓋，只涵蓋最舊的紀錄之後的期間
+	stats := analytics.Stats(time.Minute, 0)
+	assert.True(t, stats.Truncated)
+	assert.Equal(t, time.Unix(93, 0), stats.From)
+	assert.Equal(t, time.Unix(100, 0), stats.To)
+	assert.Equal(t, "7s", stats.Window)
+	assert.Equal(t, 3, stats.Searches)
+	assert.Equal(t, float64(4), stats.LatencyP50Ms)
+	assert.Equal(t, float64(5), stats.LatencyP95Ms)
+	assert.Equal(t, []QueryCount{{Query: "q3", Count: 1}, {Query: "q4", Count: 1}, {Query: "q5", Count: 1}}, stats.TopQueries)
+
+	// 要求的期間內沒有被覆蓋的紀錄時不截短
+	stats = analytics.Stats(6*time.Second, 0)
+	assert.False(t, stats.Truncated)
+	assert.Equal(t, "6s", stats.Window)
+	assert.Equal(t, 2, stats.Searches)
+}
+
+func TestSearchCache(t *testing.T) {
+	searches := 0
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			searches++
+			return searchResponse("露營 A", "露營 B"), nil
+		},
+	}
+	backend, err := cache.NewLRU(10)
+	assert.NoError(t, err)
+	analytics := NewSearchAnalytics()
+	svc := NewIdeaService(client, WithSearchCache(NewSearchCache(backend, time.Minute)), WithSearchRecorder(analytics))
+	ctx := context.Background()
+
+	// 條件的順序、空白與預設的 limit 不影響快取鍵，快取命中仍計入搜尋統計
+	first, err := svc.SearchIdeas(ctx, SearchParams{Query: "rewilding_mode=露營&keyword=森林", Fields: []string{"name"}})
+	assert.NoError(t, err)
+	cached, err := svc.SearchIdeas(ctx, SearchParams{Query: "keyword=%20森林&rewilding_mode=露營", Limit: defaultLimit, Fields: []string{"name"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, searches)
+	assert.Equal(t, first, cached)
+	assert.Equal(t, 2, analytics.Stats(time.Hour, 0).Searches)
+
+	// 不同的分頁參數或排序分開快取
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "keyword=森林&rewilding_mode=露營", Limit: 2, Fields: []string{"name"}})
+	assert.NoError(t, err)
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "keyword=森林&rewilding_mode=露營", Rank: "popular", Fields: []string{"name"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, searches)
+
+	// 續頁與個人化搜尋不快取
+	_, err = svc.SearchIdeas(ctx, SearchParams{Cursor: first.NextCursor})
+	assert.NoError(t, err)
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "keyword=森林", Prefer: &UserProfile{PreferModes: []string{"露營"}}})
+	assert.NoError(t, err)
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "keyword=森林", Prefer: &UserProfile{PreferModes: []string{"露營"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, searches)
+
+	// 寫入失敗時保留快取，成功時清除
+	client.deleteFunc = func(index string, id int64) error { return fmt.Errorf("connection refused") }
+	assert.Error(t, svc.DeleteIdea(ctx, 1, 0))
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "rewilding_mode=露營&keyword=森林", Fields: []string{"name"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, searches)
+
+	_, err = svc.CreateIdea(ctx, &model.IdeaData{Name: "新的 idea"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, backend.Len())
+	_, err = svc.SearchIdeas(ctx, SearchParams{Query: "rewilding_mode=露營&keyword=森林", Fields: []string{"name"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, searches)
+}
+
+func TestSearchIdeasTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(nooptrace.NewTracerProvider())
+
+	client := &mockManticore{
+		searchFunc: func(searchRequest *manticoresearch.SearchRequest) (*manticoresearch.SearchResponse, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+	svc := NewIdeaService(client)
+
+	_, err := svc.SearchIdeas(context.Background(), SearchParams{Query: "keyword=露營"})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	factory, search := spans[0], spans[1]
+	assert.Equal(t, "QueryFactory.CreateSearchRequest", factory.Name())
+	assert.Equal(t, "IdeaService.SearchIdeas", search.Name())
+	assert.Equal(t, search.SpanContext().SpanID(), factory.Parent().SpanID())
+	assert.Equal(t, codes.Error, search.Status().Code)
+}
+
+// mockInspector 回傳固定的表與叢集狀態
+type mockInspector struct {
+	fields      []manticore.Field
+	describeErr error
+	status      map[string]string
+	replication map[string]string
+}
+
+func (m *mockInspector) Describe(ctx context.Context, table string) ([]manticore.Field, error) {
+	return m.fields, m.describeErr
+}
+
+func (m *mockInspector) TableStatus(ctx context.Context, table string) (map[string]string, error) {
+	return m.status, nil
+}
+
+func (m *mockInspector) ReplicationStatus(ctx context.Context) (map[string]string, error) {
+	return m.replication, nil
+}
+
+func TestReadiness(t *testing.T) {
+	fields := make([]manticore.Field, 0, len(model.IdeaColumns))
+	for _, column := range model.IdeaColumns {
+		typ := strings.Fields(column.Type)[0]
+		if typ == "string" {
+			typ = "text"
+		}
+		fields = append(fields, manticore.Field{Name: column.Name, Type: typ})
+	}
+	inspector := &mockInspector{
+		fields:      fields,
+		status:      map[string]string{"indexed_documents": "42"},
+		replication: map[string]string{},
+	}
+	svc := NewHealthService(&mockManticore{}, inspector)
+
+	report := svc.Readiness(context.Background())
+	assert.True(t, report.Ready())
+	assert.Len(t, report.Checks, 4)
+	assert.Equal(t, int64(42), report.Checks[2].Details["count"])
+	assert.Equal(t, "standalone", report.Checks[3].Details["state"])
+
+	// 欄位型別不符
+	inspector.fields = append([]manticore.Field{}, fields[1:]...)
+	inspector.fields = append(inspector.fields, manticore.Field{Name: fields[0].Name, Type: "bigint"})
+	inspector.replication = map[string]string{"cluster_name": "posts", "cluster_posts_status": "non-primary"}
+	report = svc.Readiness(context.Background())
+	assert.False(t, report.Ready())
+	assert.Equal(t, CheckFail, report.Checks[1].Status)
+	assert.Equal(t, []string{"name: expected text, got bigint"}, report.Checks[1].Details["mismatches"])
+	assert.Equal(t, CheckFail, report.Checks[3].Status)
+	assert.Equal(t, map[string]interface{}{"posts": "non-primary"}, report.Checks[3].Details["clusters"])
+
+	// 表不存在
+	inspector.describeErr = fmt.Errorf("no such table 'idea'")
+	report = svc.Readiness(context.Background())
+	assert.Equal(t, "no such table 'idea'", report.Checks[1].Error)
+}
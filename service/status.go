@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arwoosa/post/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusTransitions 定義每個狀態可以轉換到的狀態：
+// 草稿送審，審核通過後發布或退回草稿，發布後可下架，下架後回到草稿重新編輯
+var statusTransitions = map[string][]string{
+	model.StatusDraft:         {model.StatusPendingReview},
+	model.StatusPendingReview: {model.StatusPublished, model.StatusDraft},
+	model.StatusPublished:     {model.StatusArchived},
+	model.StatusArchived:      {model.StatusDraft},
+}
+
+// canTransition 判斷 idea 是否可以從 from 轉換為 to
+func canTransition(from string, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionIdea 將指定的 idea 轉換為 status 並回傳轉換後的內容。
+// status 不是已定義的狀態時回傳 ErrInvalidStatus，目前的狀態不能轉換為 status 時回傳 ErrInvalidTransition；
+// version 為客戶端讀取時的版本，與目前的版本不同時回傳 ConflictError，為 0 時不檢查。
+func (s *IdeaService) TransitionIdea(ctx context.Context, id int64, status string, version int64) (idea *model.IdeaData, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.TransitionIdea", trace.WithAttributes(
+		attribute.Int64("idea.id", id),
+		attribute.String("idea.status", status),
+	))
+	defer func() { endSpan(span, err) }()
+
+	if !model.IsValidStatus(status) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+
+	unlock := lockIdea(id)
+	defer unlock()
+
+	idea, err = s.GetIdea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(id, idea, version); err != nil {
+		return nil, err
+	}
+	if !canTransition(idea.Status, status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, idea.Status, status)
+	}
+
+	idea.Status = status
+	idea.Updated_at = s.now().Unix()
+	idea.Version++
+	if err := s.client.Update(ctx, s.index, id, map[string]interface{}{
+		"status":     idea.Status,
+		"updated_at": idea.Updated_at,
+		"version":    idea.Version,
+	}); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return idea, nil
+}
+
+// validateStatuses 檢查搜尋指定的狀態都是已定義的狀態
+func validateStatuses(statuses []string) error {
+	for _, status := range statuses {
+		if !model.IsValidStatus(status) {
+			return fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+		}
+	}
+	return nil
+}
+
+// withStatuses 回傳加上狀態過濾條件的 filters 副本，未指定狀態時只搜尋已發布的 idea；
+// 查詢字串中的 status 條件會被覆蓋，公開搜尋因此無法查詢其他狀態
+func withStatuses(filters map[string]interface{}, statuses []string) map[string]interface{} {
+	scoped := make(map[string]interface{}, len(filters)+1)
+	for key, value := range filters {
+		scoped[key] = value
+	}
+	scoped["status"] = model.StatusPublished
+	if len(statuses) > 0 {
+		scoped["status"] = strings.Join(statuses, "|")
+	}
+	return scoped
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer 建立服務層的 span，未設定 TracerProvider 時不會輸出任何資料
+var tracer = otel.Tracer("github.com/arwoosa/post/service")
+
+// endSpan 結束 span，err 不為 nil 時記錄錯誤並標記為失敗
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
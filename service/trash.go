@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arwoosa/post/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// purgeBatchSize PurgeTrash 每次搜尋並刪除的筆數
+const purgeBatchSize = 100
+
+// RestoreIdea 將資源回收筒中的 idea 還原並回傳還原後的內容，未刪除的 idea 原樣回傳
+func (s *IdeaService) RestoreIdea(ctx context.Context, id int64) (idea *model.IdeaData, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.RestoreIdea", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	unlock := lockIdea(id)
+	defer unlock()
+
+	idea, err = s.readIdea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if idea.Deleted_at == 0 {
+		return idea, nil
+	}
+
+	idea.Deleted_at = 0
+	idea.Version++
+	if err := s.client.Update(ctx, s.index, id, map[string]interface{}{
+		"deleted_at": idea.Deleted_at,
+		"version":    idea.Version,
+	}); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx)
+	return idea, nil
+}
+
+// TrashedIdea 讀取資源回收筒中的 idea，不存在或未刪除時回傳 ErrIdeaNotFound
+func (s *IdeaService) TrashedIdea(ctx context.Context, id int64) (idea *model.IdeaData, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.TrashedIdea", trace.WithAttributes(attribute.Int64("idea.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	idea, err = s.readIdea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if idea.Deleted_at == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrIdeaNotFound, id)
+	}
+	return idea, nil
+}
+
+// TrashIdeas 以頁碼分頁列出資源回收筒中的 idea，依刪除時間由新到舊排序；ownerID 不為空時只列出該使用者擁有的 idea
+func (s *IdeaService) TrashIdeas(ctx context.Context, ownerID string, page int32, pageSize int32) (response *model.SearchResponse, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.TrashIdeas")
+	defer func() { endSpan(span, err) }()
+
+	if page == 0 {
+		page = 1
+	}
+	params := SearchParams{Page: page, PageSize: pageSize}
+	if err := s.normalize(&params); err != nil {
+		return nil, err
+	}
+
+	searchRequest := NewQueryFactory().CreateTrashRequest(s.index, 0, ownerID)
+	searchRequest.SetLimit(params.PageSize)
+	searchRequest.SetOffset((params.Page - 1) * params.PageSize)
+	result, err := s.client.Search(ctx, searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("執行搜尋失敗: %w", err)
+	}
+	response = model.FromManticoreResponse(result)
+	s.paginateByPage(response, params)
+	return response, nil
+}
+
+// PurgeTrash 永久刪除在資源回收筒中超過 olderThan 的 idea，回傳刪除的筆數。
+// 刪除前持有 lockIdea 重新讀取，搜尋之後被還原或重新刪除的 idea 不會被刪除
+func (s *IdeaService) PurgeTrash(ctx context.Context, olderThan time.Duration) (purged int, err error) {
+	ctx, span := tracer.Start(ctx, "IdeaService.PurgeTrash")
+	defer func() {
+		span.SetAttributes(attribute.Int("trash.purged", purged))
+		endSpan(span, err)
+	}()
+
+	before := s.now().Add(-olderThan).Unix()
+	seen := make(map[uint64]bool)
+	for {
+		searchRequest := NewQueryFactory().CreateTrashRequest(s.index, before, "")
+		searchRequest.SetLimit(purgeBatchSize)
+		result, err := s.client.Search(ctx, searchRequest)
+		if err != nil {
+			return purged, fmt.Errorf("執行搜尋失敗: %w", err)
+		}
+		ideas := model.FromManticoreResponse(result).Data
+		if len(ideas) == 0 {
+			return purged, nil
+		}
+		for _, idea := range ideas {
+			// 已處理的 idea 再次出現表示刪除沒有生效，避免無限迴圈
+			if seen[idea.ID] {
+				return purged, fmt.Errorf("idea %d 處理後仍在資源回收筒中", idea.ID)
+			}
+			seen[idea.ID] = true
+			deleted, err := s.purgeIdea(ctx, int64(idea.ID), before)
+			if err != nil {
+				return purged, err
+			}
+			if deleted {
+				purged++
+			}
+		}
+	}
+}
+
+// purgeIdea 在 idea 仍於 before 之前被移到資源回收筒時永久刪除，回傳是否刪除
+func (s *IdeaService) purgeIdea(ctx context.Context, id int64, before int64) (bool, error) {
+	unlock := lockIdea(id)
+	defer unlock()
+
+	idea, err := s.readIdea(ctx, id)
+	if errors.Is(err, ErrIdeaNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if idea.Deleted_at == 0 || idea.Deleted_at >= before {
+		return false, nil
+	}
+	if err := s.client.Delete(ctx, s.index, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arwoosa/post/pkg/logging"
+)
+
+// IndexVersion 記錄 idea 表的寫入版本，用於產生搜尋結果的 ETag，
+// 不需要執行搜尋即可判斷客戶端保存的結果是否仍然有效
+type IndexVersion interface {
+	// Current 回傳目前的版本與最後寫入的時間
+	Current(ctx context.Context) (version string, modified time.Time, err error)
+
+	// Bump 在新增、更新、刪除 idea 或彙總熱門度後遞增版本
+	Bump(ctx context.Context) error
+}
+
+// WithIndexVersion 指定 idea 表的 IndexVersion，未指定時搜尋結果不提供 ETag
+func WithIndexVersion(version IndexVersion) IdeaServiceOption {
+	return func(s *IdeaService) {
+		s.version = version
+	}
+}
+
+// LocalIndexVersion 行程內的 IndexVersion，以啟動時產生的隨機值區分不同的程序。
+// 多個實例時其他實例的寫入不會遞增版本，需改用共用的實作，例如存放在 Redis。
+type LocalIndexVersion struct {
+	epoch string
+	now   func() time.Time
+
+	mu       sync.Mutex
+	counter  uint64
+	modified time.Time
+}
+
+// NewLocalIndexVersion 創建 LocalIndexVersion，最後寫入的時間初始為啟動時間
+func NewLocalIndexVersion() *LocalIndexVersion {
+	epoch := make([]byte, 8)
+	if _, err := rand.Read(epoch); err != nil {
+		panic(fmt.Errorf("產生索引版本失敗: %w", err))
+	}
+	return &LocalIndexVersion{
+		epoch:    hex.EncodeToString(epoch),
+		now:      time.Now,
+		modified: time.Now(),
+	}
+}
+
+// Current 實現 IndexVersion
+func (v *LocalIndexVersion) Current(ctx context.Context) (string, time.Time, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return fmt.Sprintf("%s-%d", v.epoch, v.counter), v.modified, nil
+}
+
+// Bump 實現 IndexVersion
+func (v *LocalIndexVersion) Bump(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.counter++
+	v.modified = v.now()
+	return nil
+}
+
+// SearchETag 以正規化後的搜尋參數與目前的索引版本產生搜尋結果的弱驗證 ETag，
+// modified 為最後寫入 idea 的時間。未設定 IndexVersion 或參數錯誤時 ok 為 false。
+// 版本應在搜尋之前取得，搜尋期間有寫入時客戶端下次請求會得到新的 ETag，不會誤判為未修改。
+func (s *IdeaService) SearchETag(ctx context.Context, params SearchParams) (etag string, modified time.Time, ok bool) {
+	if s.version == nil {
+		return "", time.Time{}, false
+	}
+	if err := s.normalize(&params); err != nil {
+		return "", time.Time{}, false
+	}
+	version, modified, err := s.version.Current(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "read index version failed", logging.KeyError, err.Error())
+		return "", time.Time{}, false
+	}
+	sum := sha256.Sum256([]byte(version + "\n" + searchKey(params)))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, modified, true
+}